@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/montanaflynn/stats"
+)
+
+// maxPositions is the number of positions in a post analysis, later images are
+// counted in the last position.
+const maxPositions = 10
+
+// PostAnalysis breaks down how posts score by the position of their images and
+// their size.
+type PostAnalysis struct {
+	// Posts is the number of posts analyzed.
+	Posts int
+	// Positions are the scores of images by their position in the post, the cover first.
+	Positions []PositionStats
+	// CoverDropOff is the median, over posts with more than one image, of the mean
+	// score of the other images divided by the score of the cover. 0.5 means the
+	// other images typically score half as much as the cover.
+	CoverDropOff float64
+	// Sizes are the scores of posts by their number of images.
+	Sizes []SizeStats
+	// BestScoreSize and BestEfficiencySize are the post sizes with the highest mean
+	// post score and score per image, among sizes with enough posts. Zero if none has.
+	BestScoreSize, BestEfficiencySize int
+}
+
+// PositionStats are the scores of the images at one position in their post.
+type PositionStats struct {
+	// Position is the 0 based position, the last PositionStats includes every later image.
+	Position     int
+	Images       int
+	Mean, Median float64
+	// RelativeToCover is the median of the image score divided by the cover score of its post.
+	RelativeToCover float64
+}
+
+// Label returns the 1 based position, "10+" for the last.
+func (p PositionStats) Label() string {
+	if p.Position == maxPositions-1 {
+		return fmt.Sprintf("%d+", p.Position+1)
+	}
+	return fmt.Sprint(p.Position + 1)
+}
+
+// SizeStats are the scores of the posts with one number of images.
+type SizeStats struct {
+	Size           int
+	Posts          int
+	MeanScore      float64
+	MeanEfficiency float64
+}
+
+// analyzePosts analyzes the posts older than minAge. Sizes need at least minPosts
+// posts to be the best size.
+func analyzePosts(posts []*post, minAge time.Duration, minPosts int) *PostAnalysis {
+	posts = Filter(posts, func(p *post) bool {
+		return time.Since(p.PublishedAt()) >= minAge
+	})
+	a := &PostAnalysis{Posts: len(posts)}
+
+	scores := make([][]float64, maxPositions)
+	ratios := make([][]float64, maxPositions)
+	var dropOffs []float64
+	sizes := make(map[int]*SizeStats)
+	maxSize := 0
+	for _, p := range posts {
+		cover := float64(First(p.images).Score())
+		var others float64
+		for n, i := range p.images {
+			pos := min(n, maxPositions-1)
+			score := float64(i.Score())
+			scores[pos] = append(scores[pos], score)
+			if cover > 0 {
+				ratios[pos] = append(ratios[pos], score/cover)
+			}
+			if n > 0 {
+				others += score
+			}
+		}
+		if len(p.images) > 1 && cover > 0 {
+			dropOffs = append(dropOffs, others/float64(len(p.images)-1)/cover)
+		}
+
+		size := len(p.images)
+		if sizes[size] == nil {
+			sizes[size] = &SizeStats{Size: size}
+		}
+		s := sizes[size]
+		s.Posts++
+		s.MeanScore += float64(p.Score())
+		s.MeanEfficiency += p.Efficiency()
+		maxSize = max(maxSize, size)
+	}
+
+	for pos := range scores {
+		if len(scores[pos]) == 0 {
+			continue
+		}
+		ps := PositionStats{Position: pos, Images: len(scores[pos])}
+		ps.Mean, _ = stats.Mean(scores[pos])
+		ps.Median, _ = stats.Median(scores[pos])
+		ps.RelativeToCover, _ = stats.Median(ratios[pos])
+		a.Positions = append(a.Positions, ps)
+	}
+	a.CoverDropOff, _ = stats.Median(dropOffs)
+
+	var bestScore, bestEfficiency float64
+	for size := 1; size <= maxSize; size++ {
+		s := sizes[size]
+		if s == nil {
+			continue
+		}
+		s.MeanScore /= float64(s.Posts)
+		s.MeanEfficiency /= float64(s.Posts)
+		a.Sizes = append(a.Sizes, *s)
+		if s.Posts < minPosts {
+			continue
+		}
+		if s.MeanScore > bestScore {
+			bestScore, a.BestScoreSize = s.MeanScore, size
+		}
+		if s.MeanEfficiency > bestEfficiency {
+			bestEfficiency, a.BestEfficiencySize = s.MeanEfficiency, size
+		}
+	}
+	return a
+}
+
+// printPostAnalysis writes a post analysis as tables.
+func printPostAnalysis(w io.Writer, a *PostAnalysis) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "position\timages\tmean\tmedian\tvs cover\t\n")
+	for _, p := range a.Positions {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.0f\t%.0f%%\t\n", p.Label(), p.Images, p.Mean, p.Median, p.RelativeToCover*100)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "size\tposts\tmean score\tmean efficiency\t\n")
+	for _, s := range a.Sizes {
+		fmt.Fprintf(tw, "%d\t%d\t%.1f\t%.1f\t\n", s.Size, s.Posts, s.MeanScore, s.MeanEfficiency)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n%d posts. Images after the cover score %.0f%% of the cover (median).\n", a.Posts, a.CoverDropOff*100)
+	if a.BestScoreSize > 0 {
+		fmt.Fprintf(w, "Best post size: %d images by post score, %d by score per image.\n", a.BestScoreSize, a.BestEfficiencySize)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/montanaflynn/stats"
+)
+
+// AnomalyDetector flags images scoring far above or below what is expected for their
+// age, the size of their post and the hour they were published.
+//
+// The baseline is a least squares fit of log(1+score) on log(age), its square, the
+// log of the post size and the hour of day as a point on a circle. Residuals are
+// scaled by their median absolute deviation, so a handful of viral hits don't hide
+// each other.
+type AnomalyDetector struct {
+	// Threshold is the robust z-score beyond which an image is an anomaly.
+	Threshold float64
+	// MinAge excludes images younger than this, their score is still growing quickly.
+	MinAge time.Duration
+}
+
+// Anomaly is an image that performed far from expectation.
+type Anomaly struct {
+	*image
+	Expected float64
+	// Z is the robust z-score of the residual, positive above expectation.
+	Z float64
+}
+
+// Kind is hit for anomalies above expectation and dead for those below.
+func (a *Anomaly) Kind() string {
+	if a.Z > 0 {
+		return "hit"
+	}
+	return "dead"
+}
+
+// errTooFewImages is returned by Detect if there aren't enough images to fit the baseline.
+var errTooFewImages = fmt.Errorf("need more than %d images to fit a baseline", anomalyFeatures)
+
+// anomalyFeatures is the number of coefficients of the baseline.
+const anomalyFeatures = 6
+
+func anomalyFeatureVector(i *image, size int, now time.Time) [anomalyFeatures]float64 {
+	age := math.Log(max(now.Sub(i.PublishedAt).Hours()/24, 1.0/24))
+	hour := 2 * math.Pi * float64(i.Hour()) / 24
+	return [anomalyFeatures]float64{1, age, age * age, math.Log(float64(size)), math.Sin(hour), math.Cos(hour)}
+}
+
+// Detect fits the baseline to the posts and returns every image beyond the threshold,
+// largest deviation first.
+func (a *AnomalyDetector) Detect(posts []*post) ([]*Anomaly, error) {
+	now := time.Now()
+	var images []*image
+	var xs [][anomalyFeatures]float64
+	var ys []float64
+	for _, p := range posts {
+		for _, i := range p.images {
+			if now.Sub(i.PublishedAt) < a.MinAge {
+				continue
+			}
+			images = append(images, i)
+			xs = append(xs, anomalyFeatureVector(i, len(p.images), now))
+			ys = append(ys, math.Log1p(float64(i.Score())))
+		}
+	}
+	if len(images) <= anomalyFeatures {
+		return nil, fmt.Errorf("%w older than %s, got %d", errTooFewImages, a.MinAge, len(images))
+	}
+	beta, err := leastSquares(xs, ys)
+	if err != nil {
+		return nil, err
+	}
+
+	predicted := make([]float64, len(images))
+	residuals := make([]float64, len(images))
+	for n, x := range xs {
+		for k := range x {
+			predicted[n] += beta[k] * x[k]
+		}
+		residuals[n] = ys[n] - predicted[n]
+	}
+	mad, _ := stats.MedianAbsoluteDeviation(residuals)
+	sigma := 1.4826 * mad
+	if sigma == 0 {
+		return nil, nil
+	}
+
+	var anomalies []*Anomaly
+	for n, i := range images {
+		z := residuals[n] / sigma
+		if math.Abs(z) < a.Threshold {
+			continue
+		}
+		anomalies = append(anomalies, &Anomaly{
+			image:    i,
+			Expected: math.Expm1(predicted[n]),
+			Z:        z,
+		})
+	}
+	slices.SortStableFunc(anomalies, func(a, b *Anomaly) int {
+		return cmp.Compare(math.Abs(b.Z), math.Abs(a.Z))
+	})
+	return anomalies, nil
+}
+
+// leastSquares solves the normal equations of the linear regression of ys on xs.
+func leastSquares(xs [][anomalyFeatures]float64, ys []float64) ([]float64, error) {
+	const k = anomalyFeatures
+	// augmented matrix [X'X | X'y]
+	var m [k][k + 1]float64
+	for n, x := range xs {
+		for i := range k {
+			for j := range k {
+				m[i][j] += x[i] * x[j]
+			}
+			m[i][k] += x[i] * ys[n]
+		}
+	}
+	// a little ridge regularization keeps the system solvable when a feature doesn't
+	// vary, such as the post size of a creator who only posts single images
+	for i := 1; i < k; i++ {
+		m[i][i] += 1e-6 * float64(len(xs))
+	}
+	// gaussian elimination with partial pivoting
+	for col := range k {
+		pivot := col
+		for row := col + 1; row < k; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, errors.New("baseline is degenerate, images are too similar in age, post size or hour")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for row := range k {
+			if row == col {
+				continue
+			}
+			f := m[row][col] / m[col][col]
+			for c := col; c <= k; c++ {
+				m[row][c] -= f * m[col][c]
+			}
+		}
+	}
+	beta := make([]float64, k)
+	for i := range k {
+		beta[i] = m[i][k] / m[i][i]
+	}
+	return beta, nil
+}
+
+// printAnomalies writes anomalies as a table.
+func printAnomalies(w io.Writer, anomalies []*Anomaly) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "kind\tpublished\tscore\texpected\tz\turl")
+	for _, a := range anomalies {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.0f\t%+.1f\t%s\n", a.Kind(), a.DateTime(), a.Score(), a.Expected, a.Z, a.ImageURL())
+	}
+	return tw.Flush()
+}
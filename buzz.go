@@ -0,0 +1,133 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	stdcsv "encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d00918380/civit/internal/trpc"
+)
+
+// buzzTransaction is a trpc.Transaction seen from the current user's account.
+type buzzTransaction struct {
+	Date time.Time `json:"date"`
+	Type string    `json:"type"`
+	// Amount is positive for buzz received and negative for buzz spent.
+	Amount       int    `json:"amount"`
+	Counterparty string `json:"counterparty"`
+	Description  string `json:"description"`
+}
+
+// Category groups transactions for the summary.
+func (t *buzzTransaction) Category() string {
+	switch typ := strings.ToLower(t.Type); {
+	case typ == "tip" && t.Amount > 0:
+		return "tips received"
+	case typ == "tip":
+		return "tips sent"
+	case typ == "generation" || typ == "image":
+		return "generation spend"
+	case typ == "reward" || typ == "dailyboost" || typ == "bounty":
+		return "rewards"
+	default:
+		return typ
+	}
+}
+
+func newBuzzTransaction(account int, t trpc.Transaction) *buzzTransaction {
+	bt := &buzzTransaction{
+		Date:        t.Date,
+		Type:        t.Type,
+		Amount:      t.Amount,
+		Description: t.Description,
+	}
+	counterparty := t.ToUser
+	if t.ToAccountID == account {
+		counterparty = t.FromUser
+	} else {
+		bt.Amount = -t.Amount
+	}
+	if counterparty != nil {
+		bt.Counterparty = counterparty.Username
+	}
+	return bt
+}
+
+// buzzTransactions fetches every transaction of the current user made after since.
+func buzzTransactions(ctx context.Context, c *trpc.Client, since time.Time) ([]*buzzTransaction, error) {
+	account, err := c.BuzzGetUserAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var txs []*buzzTransaction
+	for t, err := range c.BuzzTransactions(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		if t.Date.Before(since) {
+			break // newest first
+		}
+		txs = append(txs, newBuzzTransaction(account.ID, t))
+	}
+	return txs, nil
+}
+
+func writeTransactionsCSV(w io.Writer, txs []*buzzTransaction) error {
+	cw := stdcsv.NewWriter(w)
+	cw.Write([]string{"date", "type", "category", "amount", "counterparty", "description"})
+	for _, t := range txs {
+		cw.Write([]string{
+			t.Date.In(tz).Format(time.RFC3339),
+			t.Type,
+			t.Category(),
+			strconv.Itoa(t.Amount),
+			t.Counterparty,
+			t.Description,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeTransactionsJSON(w io.Writer, txs []*buzzTransaction) error {
+	return json.NewEncoder(w).Encode(txs)
+}
+
+// writeTransactionsSummary writes the count and total amount per category, largest first.
+func writeTransactionsSummary(w io.Writer, txs []*buzzTransaction) error {
+	type total struct {
+		category string
+		count    int
+		amount   int
+	}
+	totals := make(map[string]*total)
+	for _, t := range txs {
+		c := t.Category()
+		if totals[c] == nil {
+			totals[c] = &total{category: c}
+		}
+		totals[c].count++
+		totals[c].amount += t.Amount
+	}
+	var sorted []*total
+	for _, t := range totals {
+		sorted = append(sorted, t)
+	}
+	slices.SortFunc(sorted, func(a, b *total) int {
+		abs := func(n int) int { return max(n, -n) }
+		return cmp.Compare(abs(b.amount), abs(a.amount))
+	})
+	for _, t := range sorted {
+		if _, err := fmt.Fprintf(w, "%-20s %6d %10d\n", t.category, t.count, t.amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
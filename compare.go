@@ -0,0 +1,140 @@
+package main
+
+import (
+	"cmp"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/d00918380/civit/internal/trpc"
+	"github.com/montanaflynn/stats"
+)
+
+//go:embed compare.html
+var compareHTML string
+
+// creatorSummary are the per image statistics of one creator for report compare.
+type creatorSummary struct {
+	User   string
+	Images int
+	Posts  int
+	// ImagesPerDay is the number of images published per day over the compared period.
+	ImagesPerDay float64
+	// Mean, P50 and P90 are of the score per image.
+	Mean, P50, P90 float64
+	// Efficiency is the mean score per image of posts.
+	Efficiency float64
+	// Leaderboard is the leaderboard score over the last 30 days.
+	Leaderboard float64
+	// Hours is the mean score per image by hour of day, in --tz.
+	Hours [24]hourSummary
+	// BestHours are the hours with the highest mean score per image and at least
+	// three images.
+	BestHours []int
+	// Growth is the trend of the score per image, as the percentage of Mean it changes
+	// by every 30 days. Young images haven't collected all their reactions yet, so
+	// compare it between creators rather than reading it on its own.
+	Growth float64
+}
+
+type hourSummary struct {
+	Images int
+	Mean   float64
+}
+
+// summarizeCreator summarizes the published items of a dump from since on.
+// A zero since summarizes all items.
+func summarizeCreator(items []*trpc.Item, since time.Time) (*creatorSummary, error) {
+	items = Filter(items, func(i *trpc.Item) bool {
+		return i.Published() && !i.PublishedAt.Before(since)
+	})
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no published images since %s", since.Format(time.DateOnly))
+	}
+	d := &data{Items: items}
+	images := d.Images()
+	posts := d.Posts()
+	scores := Map(images, func(i *image) float64 {
+		return float64(i.Score())
+	})
+	s := &creatorSummary{
+		User:        d.User(),
+		Images:      len(images),
+		Posts:       len(posts),
+		Leaderboard: d.Leaderboard().Score(),
+	}
+	s.Mean, _ = stats.Mean(scores)
+	s.P50, _ = stats.Percentile(scores, 50)
+	s.P90, _ = stats.Percentile(scores, 90)
+	s.Efficiency, _ = stats.Mean(Map(posts, func(p *post) float64 {
+		return p.Efficiency()
+	}))
+
+	first := slices.MinFunc(images, func(a, b *image) int {
+		return a.PublishedAt.Compare(b.PublishedAt)
+	}).PublishedAt
+	if !since.IsZero() {
+		first = since
+	}
+	days := max(time.Since(first).Hours()/24, 1)
+	s.ImagesPerDay = float64(len(images)) / days
+
+	var sums [24]float64
+	for _, i := range images {
+		h := i.Hour()
+		s.Hours[h].Images++
+		sums[h] += float64(i.Score())
+	}
+	for h := range s.Hours {
+		if s.Hours[h].Images > 0 {
+			s.Hours[h].Mean = sums[h] / float64(s.Hours[h].Images)
+		}
+		if s.Hours[h].Images >= 3 {
+			s.BestHours = append(s.BestHours, h)
+		}
+	}
+	slices.SortStableFunc(s.BestHours, func(a, b int) int {
+		return cmp.Compare(s.Hours[b].Mean, s.Hours[a].Mean)
+	})
+	s.BestHours = s.BestHours[:min(3, len(s.BestHours))]
+
+	if len(images) > 1 && s.Mean > 0 {
+		xs := Map(images, func(i *image) float64 {
+			return i.PublishedAt.Sub(first).Hours() / 24
+		})
+		s.Growth = percent(linearFit(xs, scores).Slope*30, s.Mean)
+	}
+	return s, nil
+}
+
+// compareReport renders the creators of several dumps side by side.
+// Only images published in the last days are compared, all if days is 0.
+func compareReport(w io.Writer, inputs []string, days int) error {
+	var since time.Time
+	if days > 0 {
+		since = truncateDay(time.Now().In(tz)).AddDate(0, 0, -days)
+	}
+	var creators []*creatorSummary
+	for _, input := range inputs {
+		items, err := readItems(input)
+		if err != nil {
+			return err
+		}
+		s, err := summarizeCreator(items, since)
+		if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+		creators = append(creators, s)
+	}
+	t, err := template.New("compare.html").Parse(compareHTML)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, struct {
+		Creators []*creatorSummary
+		Since    time.Time
+	}{creators, since})
+}
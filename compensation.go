@@ -0,0 +1,218 @@
+package main
+
+import (
+	_ "embed"
+	stdcsv "encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+//go:embed compensation.html
+var compensationHTML string
+
+// compensationSample is one row of compensation.csv written by ReactionsProcessor.processCompensation.
+type compensationSample struct {
+	Time time.Time `json:"time"`
+	// Value is the value of the pool in US dollars.
+	Value float64 `json:"value"`
+	// Current and Forecasted are the banked buzz.
+	Current    float64 `json:"current"`
+	Forecasted float64 `json:"forecasted"`
+}
+
+// Rate returns the dollars paid per banked buzz if the pool closed now.
+func (s compensationSample) Rate() float64 {
+	if s.Current == 0 {
+		return 0
+	}
+	return s.Value / s.Current
+}
+
+// ForecastedRate returns the dollars per buzz at the forecasted pool size.
+func (s compensationSample) ForecastedRate() float64 {
+	if s.Forecasted == 0 {
+		return 0
+	}
+	return s.Value / s.Forecasted
+}
+
+func readCompensation(path string) ([]compensationSample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := stdcsv.NewReader(f)
+	cr.FieldsPerRecord = 4
+	var samples []compensationSample
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ts, err := time.ParseInLocation(time.DateTime, record[0], time.Local)
+		if err != nil {
+			return nil, err
+		}
+		var v [3]float64
+		for i, f := range record[1:] {
+			if v[i], err = strconv.ParseFloat(f, 64); err != nil {
+				return nil, err
+			}
+		}
+		samples = append(samples, compensationSample{ts, v[0], v[1], v[2]})
+	}
+}
+
+// compensationHistory renders the history of the pool as HTML.
+func compensationHistory(w io.Writer, samples []compensationSample) error {
+	t, err := template.New("compensation.html").Funcs(template.FuncMap{"json": jsonJS}).Parse(compensationHTML)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, samples)
+}
+
+// PoolEstimate is the projected state of the compensation pool at month end.
+type PoolEstimate struct {
+	At      time.Time
+	Value   float64
+	Samples int
+	// Size is the projected banked buzz, Low and High the bounds of its 95% prediction interval.
+	Size, Low, High float64
+}
+
+// Rate returns the projected dollars per buzz.
+func (e *PoolEstimate) Rate() float64 {
+	if e.Size == 0 {
+		return 0
+	}
+	return e.Value / e.Size
+}
+
+// RateRange returns the bounds of the dollars per buzz. A larger pool pays less per buzz,
+// so the low rate comes from the high size.
+func (e *PoolEstimate) RateRange() (float64, float64) {
+	if e.High == 0 {
+		return 0, 0
+	}
+	return e.Value / e.High, e.Value / max(e.Low, 1)
+}
+
+// estimatePool projects the banked buzz at the end of the month, in tz, of the latest
+// sample by fitting a line through that month's samples.
+// With fewer than three samples the forecast published by Civitai is used as is.
+func estimatePool(samples []compensationSample) (*PoolEstimate, error) {
+	if len(samples) == 0 {
+		return nil, errors.New("no compensation samples")
+	}
+	latest := samples[len(samples)-1]
+	at := latest.Time.In(tz)
+	start := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, tz)
+	end := start.AddDate(0, 1, 0)
+
+	var xs, ys []float64
+	for _, s := range samples {
+		if s.Time.Before(start) || s.Current == 0 {
+			continue
+		}
+		xs = append(xs, s.Time.Sub(start).Hours())
+		ys = append(ys, s.Current)
+	}
+	e := &PoolEstimate{At: end, Value: latest.Value, Samples: len(xs)}
+	if len(xs) < 3 {
+		e.Size, e.Low, e.High = latest.Forecasted, latest.Forecasted, latest.Forecasted
+		return e, nil
+	}
+	fit := linearFit(xs, ys)
+	x := end.Sub(start).Hours()
+	e.Size = fit.At(x)
+	delta := 1.96 * fit.PredictionError(x)
+	// banking only adds to the pool, so don't project below what's already banked.
+	// Extraction at the end of the month does shrink it, which the fit doesn't model.
+	e.Size = max(e.Size, latest.Current)
+	e.Low = max(e.Size-delta, latest.Current)
+	e.High = e.Size + delta
+	return e, nil
+}
+
+// fit is an ordinary least squares fit of y = Intercept + Slope*x.
+type fit struct {
+	Intercept, Slope float64
+	n                int
+	meanX, sxx       float64
+	// residual standard error
+	s float64
+}
+
+func linearFit(xs, ys []float64) fit {
+	n := float64(len(xs))
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx /= n
+	my /= n
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - mx) * (xs[i] - mx)
+		sxy += (xs[i] - mx) * (ys[i] - my)
+	}
+	f := fit{n: len(xs), meanX: mx, sxx: sxx}
+	if sxx > 0 {
+		f.Slope = sxy / sxx
+	}
+	f.Intercept = my - f.Slope*mx
+	var sse float64
+	for i := range xs {
+		r := ys[i] - f.At(xs[i])
+		sse += r * r
+	}
+	if len(xs) > 2 {
+		f.s = math.Sqrt(sse / (n - 2))
+	}
+	return f
+}
+
+// At returns the fitted value at x.
+func (f fit) At(x float64) float64 {
+	return f.Intercept + f.Slope*x
+}
+
+// PredictionError returns the standard error of a new observation at x.
+func (f fit) PredictionError(x float64) float64 {
+	if f.sxx == 0 {
+		return f.s
+	}
+	n := float64(f.n)
+	return f.s * math.Sqrt(1+1/n+(x-f.meanX)*(x-f.meanX)/f.sxx)
+}
+
+// printEstimate writes a summary of the estimated payout for banked buzz.
+func printEstimate(w io.Writer, samples []compensationSample, banked float64) error {
+	e, err := estimatePool(samples)
+	if err != nil {
+		return err
+	}
+	latest := samples[len(samples)-1]
+	fmt.Fprintf(w, "Pool value:        $%.2f\n", latest.Value)
+	fmt.Fprintf(w, "Banked now:        %.0f buzz ($%.6f/buzz)\n", latest.Current, latest.Rate())
+	fmt.Fprintf(w, "Civitai forecast:  %.0f buzz ($%.6f/buzz)\n", latest.Forecasted, latest.ForecastedRate())
+	fmt.Fprintf(w, "Trend at %s: %.0f buzz (%.0f - %.0f, %d samples)\n", e.At.Format(time.DateOnly), e.Size, e.Low, e.High, e.Samples)
+	low, high := e.RateRange()
+	fmt.Fprintf(w, "Estimated rate:    $%.6f/buzz ($%.6f - $%.6f)\n", e.Rate(), low, high)
+	if banked > 0 {
+		fmt.Fprintf(w, "Estimated payout for %.0f buzz: $%.2f ($%.2f - $%.2f)\n", banked, banked*e.Rate(), banked*low, banked*high)
+	}
+	return nil
+}
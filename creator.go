@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	stdcsv "encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d00918380/civit/internal/trpc"
+)
+
+// CreatorProgram views and moves banked buzz, recording every action in an audit log.
+type CreatorProgram struct {
+	trpc  *trpc.Client
+	audit string
+	yes   bool
+	in    io.Reader
+	out   io.Writer
+}
+
+func newCreatorProgram() *CreatorProgram {
+	return &CreatorProgram{
+		trpc:  trpc.New(CLI.APIKey, CLI.Cookies),
+		audit: CLI.Creator.Audit,
+		yes:   CLI.Creator.Yes,
+		in:    os.Stdin,
+		out:   os.Stdout,
+	}
+}
+
+func (cp *CreatorProgram) Status(ctx context.Context) error {
+	banked, err := cp.trpc.CreatorProgramGetBanked(ctx)
+	if err != nil {
+		return err
+	}
+	pool, err := cp.trpc.CreatorProgramGetCompensationPool(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cp.out, "Banked:     %.0f / %.0f buzz (%.1f%% of cap)\n", banked.Total, banked.Cap.Cap, percent(banked.Total, banked.Cap.Cap))
+	fmt.Fprintf(cp.out, "Pool:       $%.2f for %.0f buzz (forecast %.0f)\n", pool.Value, pool.Size.Current, pool.Size.Forecasted)
+	fmt.Fprintf(cp.out, "Bank:       %s\n", phase(pool.Phases.Bank))
+	fmt.Fprintf(cp.out, "Extraction: %s\n", phase(pool.Phases.Extraction))
+	return nil
+}
+
+func (cp *CreatorProgram) Bank(ctx context.Context, amount int) error {
+	if amount <= 0 {
+		return fmt.Errorf("amount must be positive: %d", amount)
+	}
+	pool, err := cp.trpc.CreatorProgramGetCompensationPool(ctx)
+	if err != nil {
+		return err
+	}
+	prompt := fmt.Sprintf("Bank %d buzz? Bank window: %s.", amount, phase(pool.Phases.Bank))
+	if !cp.confirm(prompt) {
+		return cp.record("bank", amount, "cancelled")
+	}
+	if err := cp.record("bank", amount, "attempt"); err != nil {
+		return err
+	}
+	err = cp.trpc.CreatorProgramBankBuzz(ctx, amount)
+	return cp.done("bank", amount, err)
+}
+
+func (cp *CreatorProgram) Extract(ctx context.Context) error {
+	banked, err := cp.trpc.CreatorProgramGetBanked(ctx)
+	if err != nil {
+		return err
+	}
+	pool, err := cp.trpc.CreatorProgramGetCompensationPool(ctx)
+	if err != nil {
+		return err
+	}
+	amount := int(banked.Total)
+	prompt := fmt.Sprintf("Extract %d banked buzz? Extraction window: %s.", amount, phase(pool.Phases.Extraction))
+	if !cp.confirm(prompt) {
+		return cp.record("extract", amount, "cancelled")
+	}
+	if err := cp.record("extract", amount, "attempt"); err != nil {
+		return err
+	}
+	err = cp.trpc.CreatorProgramExtractBuzz(ctx)
+	return cp.done("extract", amount, err)
+}
+
+// done records the outcome of an action and returns its error, if any.
+func (cp *CreatorProgram) done(action string, amount int, err error) error {
+	result := "ok"
+	if err != nil {
+		result = "error: " + err.Error()
+	}
+	if aerr := cp.record(action, amount, result); aerr != nil {
+		if err != nil {
+			return err
+		}
+		return aerr
+	}
+	if err == nil {
+		fmt.Fprintf(cp.out, "%s %d buzz: %s\n", action, amount, result)
+	}
+	return err
+}
+
+// confirm asks the user to confirm an action unless --yes was given.
+func (cp *CreatorProgram) confirm(prompt string) bool {
+	return cp.yes || confirm(cp.in, cp.out, prompt)
+}
+
+// confirm asks a yes or no question on out and reads the answer from in, no by default.
+func confirm(in io.Reader, out io.Writer, prompt string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", prompt)
+	line, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// record appends a row to the audit log: timestamp, who, action, amount and result.
+// Actions that move buzz record an attempt before calling the API and their outcome
+// after, so a failure to write the log stops them before anything moves.
+func (cp *CreatorProgram) record(action string, amount int, result string) error {
+	out, err := os.OpenFile(cp.audit, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	cw := stdcsv.NewWriter(out)
+	cw.Write([]string{time.Now().Format(time.DateTime), who(), action, strconv.Itoa(amount), result})
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// who identifies the person running the command as user@host.
+func who() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
+
+// phase describes a window and whether it is currently open.
+func phase(window [2]time.Time) string {
+	if window[0].IsZero() {
+		return "unknown"
+	}
+	now := time.Now()
+	state := "closed"
+	if now.After(window[0]) && now.Before(window[1]) {
+		state = "open"
+	}
+	return fmt.Sprintf("%s - %s (%s)", window[0].In(tz).Format(time.DateTime), window[1].In(tz).Format(time.DateTime), state)
+}
+
+func percent(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b * 100
+}
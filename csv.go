@@ -2,7 +2,6 @@ package main
 
 import (
 	_ "embed"
-	"html/template"
 	"io"
 
 	"github.com/d00918380/civit/internal/trpc"
@@ -11,15 +10,10 @@ import (
 //go:embed csv.csv
 var csvTemplate string
 
-func csv(w io.Writer, items []*trpc.Item) error {
+// csv renders the csv template, the embedded csv.csv unless tmpl is set.
+func csv(w io.Writer, items []*trpc.Item, tmpl string) error {
 	data := &data{
 		Items: items,
 	}
-	funcs := template.FuncMap{}
-	t, err := template.New("csv.csv").Funcs(funcs).Parse(csvTemplate)
-	if err != nil {
-		return err
-	}
-
-	return t.Execute(w, data)
+	return executeTemplate(w, "csv.csv", csvTemplate, tmpl, templateFuncs(data), data)
 }
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	stdimage "image"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/d00918380/civit/internal/phash"
+	"github.com/d00918380/civit/internal/trpc"
+)
+
+// downloadedImage is an image file written by posts download, users download or
+// orchestrator download.
+type downloadedImage struct {
+	Path string
+	// Item is the published image, nil for files in generated/.
+	Item          *trpc.Item
+	DHash, PHash  phash.Hash
+	Width, Height int
+}
+
+// hashImage reads the file at path and computes its perceptual hashes.
+func hashImage(path string) (*downloadedImage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := stdimage.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &downloadedImage{
+		Path:   path,
+		DHash:  phash.DHash(img),
+		PHash:  phash.PHash(img),
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}, nil
+}
+
+// postsPath returns where posts download and users download save an image.
+func postsPath(dir string, i *trpc.Item) string {
+	return filepath.Join(dir, "posts", strconv.Itoa(i.PostID), i.URL+".jpeg")
+}
+
+// generatedFiles returns the image files below dir/generated.
+func generatedFiles(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(filepath.Join(dir, "generated"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jpeg", ".jpg", ".png":
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// Deduper finds near-duplicate downloaded images.
+type Deduper struct {
+	// Dir contains the posts/ and generated/ directories.
+	Dir string
+	// Generated includes the files in generated/, not only published images.
+	Generated bool
+	// Threshold is the largest Hamming distance of both the dHash and the pHash of
+	// near-duplicates.
+	Threshold int
+	// BlurhashDistance skips pairs of published images whose blurhashes are further
+	// apart, 0 compares every pair. Files of published images with no pair left aren't
+	// read, which only happens without Generated: generated files have no blurhash, so
+	// every published image is compared to them.
+	BlurhashDistance float64
+}
+
+// Clusters returns the groups of near-duplicates among the downloaded files of items,
+// largest first.
+func (d *Deduper) Clusters(items []*trpc.Item) ([][]*downloadedImage, error) {
+	type candidate struct {
+		path string
+		item *trpc.Item
+		blur *phash.Blurhash
+	}
+	var candidates []candidate
+	for _, i := range items {
+		path := postsPath(d.Dir, i)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		c := candidate{path: path, item: i}
+		c.blur, _ = phash.ParseBlurhash(i.Hash)
+		candidates = append(candidates, c)
+	}
+	published := len(candidates)
+	if d.Generated {
+		paths, err := generatedFiles(d.Dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			candidates = append(candidates, candidate{path: path})
+		}
+	}
+
+	// mayMatch reports whether the blurhashes of a and b don't rule out a near-duplicate
+	mayMatch := func(a, b candidate) bool {
+		if d.BlurhashDistance <= 0 || a.blur == nil || b.blur == nil {
+			return true
+		}
+		return phash.BlurhashDistance(a.blur, b.blur) <= d.BlurhashDistance
+	}
+	// only read files that may have a near-duplicate
+	needed := make([]bool, len(candidates))
+	for n := range candidates {
+		if n >= published {
+			needed[n] = true
+			continue
+		}
+		for m := range candidates {
+			if m != n && (m >= published || mayMatch(candidates[n], candidates[m])) {
+				needed[n] = true
+				break
+			}
+		}
+	}
+
+	images := make([]*downloadedImage, len(candidates))
+	var read int
+	for n, c := range candidates {
+		if !needed[n] {
+			continue
+		}
+		img, err := hashImage(c.path)
+		if err != nil {
+			log.Printf("Error hashing %v", err)
+			continue
+		}
+		img.Item = c.item
+		images[n] = img
+		read++
+	}
+	log.Printf("Hashed %d of %d files", read, len(candidates))
+
+	// union find of the near-duplicate pairs
+	parent := make([]int, len(images))
+	for n := range parent {
+		parent[n] = n
+	}
+	var find func(int) int
+	find = func(n int) int {
+		if parent[n] != n {
+			parent[n] = find(parent[n])
+		}
+		return parent[n]
+	}
+	for n, a := range images {
+		if a == nil {
+			continue
+		}
+		for m := n + 1; m < len(images); m++ {
+			b := images[m]
+			if b == nil || !mayMatch(candidates[n], candidates[m]) {
+				continue
+			}
+			if phash.Distance(a.PHash, b.PHash) <= d.Threshold && phash.Distance(a.DHash, b.DHash) <= d.Threshold {
+				parent[find(m)] = find(n)
+			}
+		}
+	}
+
+	groups := make(map[int][]*downloadedImage)
+	for n, img := range images {
+		if img != nil {
+			groups[find(n)] = append(groups[find(n)], img)
+		}
+	}
+	var clusters [][]*downloadedImage
+	for _, g := range groups {
+		if len(g) > 1 {
+			clusters = append(clusters, g)
+		}
+	}
+	slices.SortFunc(clusters, func(a, b []*downloadedImage) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), cmp.Compare(a[0].Path, b[0].Path))
+	})
+	return clusters, nil
+}
+
+// printClusters writes the clusters of near-duplicates with the score of the
+// published images.
+func printClusters(w io.Writer, clusters [][]*downloadedImage) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for n, c := range clusters {
+		fmt.Fprintf(tw, "cluster %d\t%d images\t\t\t\n", n+1, len(c))
+		for _, img := range c {
+			if img.Item == nil {
+				fmt.Fprintf(tw, "\t%s\t%dx%d\tunpublished\t\n", img.Path, img.Width, img.Height)
+				continue
+			}
+			i := &image{Item: img.Item}
+			fmt.Fprintf(tw, "\t%s\t%dx%d\tscore %d\t%s %s\n", img.Path, img.Width, img.Height, i.Score(), i.DateTime(), i.ImageURL())
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d clusters of near-duplicates\n", len(clusters))
+	return err
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	stdcsv "encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d00918380/civit/internal/parquet"
+)
+
+// exportColumn is a column that can be selected with export --columns.
+type exportColumn[T any] struct {
+	Type  parquet.Type
+	Value func(T) any
+}
+
+var imageColumns = map[string]exportColumn[*image]{
+	"id":          {parquet.Int64, func(i *image) any { return i.ID }},
+	"postId":      {parquet.Int64, func(i *image) any { return i.PostID }},
+	"index":       {parquet.Int64, func(i *image) any { return i.Index }},
+	"publishedAt": {parquet.Timestamp, func(i *image) any { return i.PublishedAt }},
+	"score":       {parquet.Int64, func(i *image) any { return i.Score() }},
+	"like":        {parquet.Int64, func(i *image) any { return i.Stats.LikeCountAllTime }},
+	"laugh":       {parquet.Int64, func(i *image) any { return i.Stats.LaughCountAllTime }},
+	"heart":       {parquet.Int64, func(i *image) any { return i.Stats.HeartCountAllTime }},
+	"cry":         {parquet.Int64, func(i *image) any { return i.Stats.CryCountAllTime }},
+	"comment":     {parquet.Int64, func(i *image) any { return i.Stats.CommentCountAllTime }},
+	"collected":   {parquet.Int64, func(i *image) any { return i.Collected() }},
+	"tipped":      {parquet.Int64, func(i *image) any { return i.Tipped() }},
+	"width":       {parquet.Int64, func(i *image) any { return i.Width }},
+	"height":      {parquet.Int64, func(i *image) any { return i.Height }},
+	"url":         {parquet.String, func(i *image) any { return i.URL }},
+	"hash":        {parquet.String, func(i *image) any { return i.Hash }},
+	"imageUrl":    {parquet.String, func(i *image) any { return string(i.ImageURL()) }},
+	"postUrl":     {parquet.String, func(i *image) any { return string(i.PostURL()) }},
+	"username":    {parquet.String, func(i *image) any { return i.User.Username }},
+}
+
+var postColumns = map[string]exportColumn[*post]{
+	"id":             {parquet.Int64, func(p *post) any { return p.Id() }},
+	"publishedAt":    {parquet.Timestamp, func(p *post) any { return p.PublishedAt() }},
+	"images":         {parquet.Int64, func(p *post) any { return len(p.Images()) }},
+	"score":          {parquet.Int64, func(p *post) any { return p.Score() }},
+	"efficiency":     {parquet.Double, func(p *post) any { return p.Efficiency() }},
+	"collected":      {parquet.Int64, func(p *post) any { return p.Collected() }},
+	"tipped":         {parquet.Int64, func(p *post) any { return p.Tipped() }},
+	"tippedPerImage": {parquet.Double, func(p *post) any { return p.TippedPerImage() }},
+	"collectRatio":   {parquet.Double, func(p *post) any { return p.CollectRatio() }},
+	"url":            {parquet.String, func(p *post) any { return string(p.PostURL()) }},
+}
+
+const (
+	defaultImageColumns = "id,postId,publishedAt,score,like,heart,collected,tipped,width,height,url"
+	defaultPostColumns  = "id,publishedAt,images,score,efficiency,collected,tipped,url"
+)
+
+// Exporter writes images or posts as a table.
+type Exporter struct {
+	// Format is one of csv, tsv, jsonl or parquet.
+	Format string
+	// Columns to write, in order. Empty selects the default columns.
+	Columns []string
+	// From and To restrict the export to images published between them, zero for no bound.
+	From, To time.Time
+	// MinScore excludes images, or posts, scoring less.
+	MinScore int
+}
+
+func (e *Exporter) include(published time.Time, score int) bool {
+	if !e.From.IsZero() && published.Before(e.From) {
+		return false
+	}
+	if !e.To.IsZero() && !published.Before(e.To) {
+		return false
+	}
+	return score >= e.MinScore
+}
+
+// ExportImages writes the selected columns of every image that passes the filters.
+func (e *Exporter) ExportImages(w io.Writer, d *data) error {
+	images := Filter(d.Images(), func(i *image) bool {
+		return e.include(i.PublishedAt, i.Score())
+	})
+	return export(e, w, imageColumns, defaultImageColumns, images)
+}
+
+// ExportPosts writes the selected columns of every post that passes the filters.
+func (e *Exporter) ExportPosts(w io.Writer, d *data) error {
+	posts := Filter(d.PostsByDate(), func(p *post) bool {
+		return e.include(p.PublishedAt(), p.Score())
+	})
+	return export(e, w, postColumns, defaultPostColumns, posts)
+}
+
+func export[T any](e *Exporter, w io.Writer, available map[string]exportColumn[T], defaults string, values []T) error {
+	names := e.Columns
+	if len(names) == 0 {
+		names = strings.Split(defaults, ",")
+	}
+	columns := make([]exportColumn[T], 0, len(names))
+	for _, name := range names {
+		c, ok := available[name]
+		if !ok {
+			var valid []string
+			for name := range available {
+				valid = append(valid, name)
+			}
+			slices.Sort(valid)
+			return fmt.Errorf("unknown column %q, valid columns are %s", name, strings.Join(valid, ","))
+		}
+		columns = append(columns, c)
+	}
+	rows := Map(values, func(v T) []any {
+		return Map(columns, func(c exportColumn[T]) any {
+			return c.Value(v)
+		})
+	})
+
+	switch e.Format {
+	case "csv", "tsv":
+		cw := stdcsv.NewWriter(w)
+		if e.Format == "tsv" {
+			cw.Comma = '\t'
+		}
+		cw.Write(names)
+		for _, row := range rows {
+			cw.Write(Map(row, formatValue))
+		}
+		cw.Flush()
+		return cw.Error()
+	case "jsonl":
+		bw := bufio.NewWriter(w)
+		for _, row := range rows {
+			// written by hand to keep the keys in column order
+			bw.WriteByte('{')
+			for i, v := range row {
+				if t, ok := v.(time.Time); ok {
+					v = t.In(tz)
+				}
+				k, _ := json.Marshal(names[i])
+				b, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				if i > 0 {
+					bw.WriteByte(',')
+				}
+				bw.Write(k)
+				bw.WriteByte(':')
+				bw.Write(b)
+			}
+			bw.WriteString("}\n")
+		}
+		return bw.Flush()
+	case "parquet":
+		pcs := make([]parquet.Column, len(names))
+		for i, name := range names {
+			pcs[i] = parquet.Column{Name: name, Type: columns[i].Type}
+		}
+		return parquet.Write(w, pcs, rows)
+	default:
+		return fmt.Errorf("unknown format %q", e.Format)
+	}
+}
+
+// formatValue formats a value for csv and tsv.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.In(tz).Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseDate parses a YYYY-MM-DD date in the --tz location, an empty string is the zero time.
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(time.DateOnly, s, tz)
+}
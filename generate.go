@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/d00918380/civit/internal/trpc"
+	"gopkg.in/yaml.v3"
+)
+
+// Recipe is a text to image request, written in YAML or JSON.
+type Recipe struct {
+	Prompt    string           `yaml:"prompt"`
+	Negative  string           `yaml:"negative"`
+	BaseModel string           `yaml:"baseModel"`
+	Resources []RecipeResource `yaml:"resources"`
+	Width     int              `yaml:"width"`
+	Height    int              `yaml:"height"`
+	Steps     int              `yaml:"steps"`
+	CFGScale  float64          `yaml:"cfgScale"`
+	Sampler   string           `yaml:"sampler"`
+	ClipSkip  int              `yaml:"clipSkip"`
+	// Seed is random when left out.
+	Seed *int64 `yaml:"seed"`
+	// Quantity is the number of images per job, 1 when left out.
+	Quantity int `yaml:"quantity"`
+	// Sweep lists values for other fields of the recipe, a job is submitted for
+	// every combination.
+	Sweep map[string][]any `yaml:"sweep"`
+}
+
+// RecipeResource is a model version used by a recipe.
+type RecipeResource struct {
+	// ID is the model version id.
+	ID       int      `yaml:"id"`
+	Strength *float64 `yaml:"strength"`
+	// Strengths sweeps the strength, a job is submitted for each.
+	Strengths []float64 `yaml:"strengths"`
+}
+
+// generationJob is one combination of the sweeps of a recipe.
+type generationJob struct {
+	Recipe
+	// Label lists the swept values of the job.
+	Label string
+}
+
+// parseRecipe parses a YAML or JSON recipe.
+func parseRecipe(b []byte) (*Recipe, error) {
+	var r Recipe
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&r); err != nil {
+		return nil, err
+	}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	for key := range r.Sweep {
+		switch key {
+		case "sweep", "resources":
+			return nil, fmt.Errorf("recipe: can't sweep %s, use strengths to sweep resources", key)
+		}
+	}
+	return &r, nil
+}
+
+// validate checks the fields every job needs.
+func (r *Recipe) validate() error {
+	switch {
+	case r.Prompt == "":
+		return errors.New("recipe: prompt is required")
+	case r.BaseModel == "":
+		return errors.New("recipe: baseModel is required")
+	case r.Width <= 0 || r.Height <= 0:
+		return errors.New("recipe: width and height are required")
+	}
+	return nil
+}
+
+// Jobs returns a job for every combination of the resource strengths and the sweeps.
+// Swept values are validated like the recipe.
+func (r *Recipe) Jobs() ([]generationJob, error) {
+	base := *r
+	base.Sweep = nil
+	jobs := []generationJob{{Recipe: base}}
+	for n, res := range r.Resources {
+		if len(res.Strengths) == 0 {
+			continue
+		}
+		var next []generationJob
+		for _, job := range jobs {
+			for _, s := range res.Strengths {
+				j := job
+				j.Resources = slices.Clone(job.Resources)
+				j.Resources[n].Strength = &s
+				j.Resources[n].Strengths = nil
+				j.Label = strings.TrimSpace(fmt.Sprintf("%s %d=%g", job.Label, res.ID, s))
+				next = append(next, j)
+			}
+		}
+		jobs = next
+	}
+	for _, key := range slices.Sorted(maps.Keys(r.Sweep)) {
+		var next []generationJob
+		for _, job := range jobs {
+			for _, v := range r.Sweep[key] {
+				j, err := job.with(key, v)
+				if err != nil {
+					return nil, err
+				}
+				j.Label = strings.TrimSpace(fmt.Sprintf("%s %s=%v", job.Label, key, v))
+				next = append(next, j)
+			}
+		}
+		jobs = next
+	}
+	for _, j := range jobs {
+		if err := j.validate(); err != nil {
+			return nil, fmt.Errorf("job %s: %w", j.Label, err)
+		}
+	}
+	return jobs, nil
+}
+
+// with returns a copy of the job with the recipe field key set to v.
+func (j generationJob) with(key string, v any) (generationJob, error) {
+	b, err := yaml.Marshal(j.Recipe)
+	if err != nil {
+		return j, err
+	}
+	var fields map[string]any
+	if err := yaml.Unmarshal(b, &fields); err != nil {
+		return j, err
+	}
+	if _, ok := fields[key]; !ok {
+		return j, fmt.Errorf("recipe: can't sweep unknown field %s", key)
+	}
+	fields[key] = v
+	if b, err = yaml.Marshal(fields); err != nil {
+		return j, err
+	}
+	var r Recipe
+	if err := yaml.Unmarshal(b, &r); err != nil {
+		return j, fmt.Errorf("recipe: sweep %s: %w", key, err)
+	}
+	j.Recipe = r
+	return j, nil
+}
+
+// request returns the orchestrator request of the job.
+func (j *generationJob) request() *trpc.GenerateImageRequest {
+	req := &trpc.GenerateImageRequest{Params: trpc.GenerationParams{
+		Prompt:         j.Prompt,
+		NegativePrompt: j.Negative,
+		BaseModel:      j.BaseModel,
+		Workflow:       "txt2img",
+		Sampler:        j.Sampler,
+		Seed:           j.Seed,
+		Steps:          j.Steps,
+		CFGScale:       j.CFGScale,
+		ClipSkip:       j.ClipSkip,
+		Width:          j.Width,
+		Height:         j.Height,
+		Quantity:       max(j.Quantity, 1),
+	}}
+	for _, r := range j.Resources {
+		req.Resources = append(req.Resources, trpc.GenerationResource{ID: r.ID, Strength: r.Strength})
+	}
+	return req
+}
+
+// finished reports whether a workflow status is final.
+func finished(status string) bool {
+	switch status {
+	case "succeeded", "failed", "expired", "canceled":
+		return true
+	}
+	return false
+}
+
+// Generator submits generation jobs and downloads their images.
+type Generator struct {
+	client *trpc.Client
+	// Interval is the delay between polls of a job's status.
+	Interval time.Duration
+	// Timeout is how long to wait for a job to finish.
+	Timeout time.Duration
+}
+
+// Run submits the jobs one at a time, waits for each to finish and downloads its
+// images into the generated/ tree. A job that fails to submit, fails or doesn't
+// finish within Timeout doesn't stop the batch. Jobs still running aren't
+// downloaded, orchestrator download fetches them once they finish.
+func (g *Generator) Run(ctx context.Context, w io.Writer, jobs []generationJob) error {
+	var failed int
+	for n, job := range jobs {
+		fmt.Fprintf(w, "job %d of %d %s\n", n+1, len(jobs), job.Label)
+		workflow, err := g.client.GenerateImage(ctx, job.request())
+		if err != nil {
+			log.Printf("Error submitting job %d: %v", n+1, err)
+			failed++
+			continue
+		}
+		if workflow, err = g.wait(ctx, workflow); err != nil {
+			log.Printf("Error waiting for workflow %s: %v", workflow.ID, err)
+			fmt.Fprintf(w, "workflow %s %s, not downloaded; run orchestrator download once it finishes\n", workflow.ID, workflow.Status)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "workflow %s %s, %.0f buzz\n", workflow.ID, workflow.Status, workflow.TotalCost)
+		if workflow.Status != "succeeded" {
+			failed++
+		}
+		if err := downloadGeneration(ctx, *workflow); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs failed", failed, len(jobs))
+	}
+	return nil
+}
+
+// wait polls the workflow until it finishes or Timeout passes.
+func (g *Generator) wait(ctx context.Context, workflow *trpc.GeneratedItem) (*trpc.GeneratedItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.Timeout)
+	defer cancel()
+	since := workflow.CreatedAt.Add(-time.Minute)
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+	for !finished(workflow.Status) {
+		select {
+		case <-ctx.Done():
+			return workflow, ctx.Err()
+		case <-ticker.C:
+		}
+		w, err := g.client.GeneratedWorkflow(ctx, workflow.ID, since)
+		if err != nil {
+			return workflow, err
+		}
+		workflow = w
+	}
+	return workflow, nil
+}
+
+// writeJobs writes the jobs a recipe expands to without submitting them.
+func writeJobs(w io.Writer, jobs []generationJob) error {
+	var images int
+	for n, job := range jobs {
+		images += max(job.Quantity, 1)
+		seed := "random"
+		if job.Seed != nil {
+			seed = fmt.Sprint(*job.Seed)
+		}
+		fmt.Fprintf(w, "job %d %s: %s %dx%d, %d steps, cfg %g, %s, seed %s\n", n+1, job.Label,
+			job.BaseModel, job.Width, job.Height, job.Steps, job.CFGScale, job.Sampler, seed)
+	}
+	_, err := fmt.Fprintf(w, "%d jobs, %d images\n", len(jobs), images)
+	return err
+}
+
+// readRecipe reads the recipe at path.
+func readRecipe(path string) (*Recipe, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseRecipe(b)
+}
@@ -10,6 +10,7 @@ require (
 	github.com/montanaflynn/stats v0.7.1
 	go.nhat.io/cookiejar v0.3.0
 	golang.org/x/net v0.39.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,36 @@
+package algorithms
+
+import "iter"
+
+// Take returns an iterator over the first n values of seq.
+// Once n values have been yielded seq is not advanced any further.
+func Take[T any](seq iter.Seq2[T, error], n int) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		if n <= 0 {
+			return
+		}
+		taken := 0
+		for v, err := range seq {
+			if !yield(v, err) || err != nil {
+				return
+			}
+			taken++
+			if taken >= n {
+				return
+			}
+		}
+	}
+}
+
+// Collect gathers the values of seq into a slice.
+// It stops at the first error and returns the values collected so far alongside it.
+func Collect[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	var r []T
+	for v, err := range seq {
+		if err != nil {
+			return r, err
+		}
+		r = append(r, v)
+	}
+	return r, nil
+}
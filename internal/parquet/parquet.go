@@ -0,0 +1,218 @@
+// package parquet writes flat tables as Apache Parquet files.
+//
+// It supports just enough of the format to load exports into pandas or DuckDB:
+// required columns of a few primitive types, a single row group, one uncompressed
+// PLAIN encoded data page per column.
+package parquet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Type is the type of a column.
+type Type int
+
+const (
+	Int64 Type = iota
+	Double
+	String
+	// Timestamp is stored as milliseconds since the unix epoch, in UTC.
+	Timestamp
+)
+
+// Column describes a column of the table.
+type Column struct {
+	Name string
+	Type Type
+}
+
+// physical types, encodings and converted types from parquet.thrift.
+const (
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	repetitionRequired = 0
+	pageTypeData       = 0
+	codecUncompressed  = 0
+)
+
+func (t Type) physical() int32 {
+	switch t {
+	case Double:
+		return typeDouble
+	case String:
+		return typeByteArray
+	default:
+		return typeInt64
+	}
+}
+
+// Write writes rows as a parquet file with the given columns.
+// Every row must have one value per column: an int or int64 for Int64, a float64 for
+// Double, a string for String and a time.Time for Timestamp.
+func Write(w io.Writer, columns []Column, rows [][]any) error {
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	if _, err := io.WriteString(cw, "PAR1"); err != nil {
+		return err
+	}
+
+	var chunks []*thrift
+	var total int64
+	for i, c := range columns {
+		page, err := encodePlain(c, i, rows)
+		if err != nil {
+			return err
+		}
+		header := &thrift{}
+		header.i32(1, pageTypeData)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(page)))
+		header.structBegin(5)
+		header.i32(1, int32(len(rows)))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.structEnd()
+		header.stop()
+
+		offset := cw.n
+		if _, err := cw.Write(header.buf); err != nil {
+			return err
+		}
+		if _, err := cw.Write(page); err != nil {
+			return err
+		}
+		size := cw.n - offset
+		total += size
+
+		chunk := &thrift{}
+		chunk.i64(2, offset)
+		chunk.structBegin(3)
+		chunk.i32(1, c.Type.physical())
+		chunk.listBegin(2, compactI32, 2)
+		chunk.varint(encodingPlain)
+		chunk.varint(encodingRLE)
+		chunk.listBegin(3, compactBinary, 1)
+		chunk.rawString(c.Name)
+		chunk.i32(4, codecUncompressed)
+		chunk.i64(5, int64(len(rows)))
+		chunk.i64(6, size)
+		chunk.i64(7, size)
+		chunk.i64(9, offset)
+		chunk.structEnd()
+		chunk.stop()
+		chunks = append(chunks, chunk)
+	}
+
+	meta := &thrift{}
+	meta.i32(1, 1)
+	meta.listBegin(2, compactStruct, len(columns)+1)
+	meta.elemBegin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.elemEnd()
+	for _, c := range columns {
+		meta.elemBegin()
+		meta.i32(1, c.Type.physical())
+		meta.i32(3, repetitionRequired)
+		meta.binary(4, c.Name)
+		switch c.Type {
+		case String:
+			meta.i32(6, convertedUTF8)
+		case Timestamp:
+			meta.i32(6, convertedTimestampMillis)
+		}
+		meta.elemEnd()
+	}
+	meta.i64(3, int64(len(rows)))
+	meta.listBegin(4, compactStruct, 1)
+	meta.elemBegin()
+	meta.listBegin(1, compactStruct, len(chunks))
+	for _, c := range chunks {
+		meta.raw(c.buf)
+	}
+	meta.i64(2, total)
+	meta.i64(3, int64(len(rows)))
+	meta.elemEnd()
+	meta.binary(6, "github.com/d00918380/civit")
+	meta.stop()
+
+	if _, err := cw.Write(meta.buf); err != nil {
+		return err
+	}
+	if err := binary.Write(cw, binary.LittleEndian, uint32(len(meta.buf))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(cw, "PAR1"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// encodePlain encodes column i of rows with the PLAIN encoding.
+func encodePlain(c Column, i int, rows [][]any) ([]byte, error) {
+	var buf []byte
+	for r, row := range rows {
+		if len(row) <= i {
+			return nil, fmt.Errorf("parquet: row %d has no value for column %q", r, c.Name)
+		}
+		v := row[i]
+		switch c.Type {
+		case Int64:
+			var n int64
+			switch v := v.(type) {
+			case int:
+				n = int64(v)
+			case int64:
+				n = v
+			default:
+				return nil, fmt.Errorf("parquet: column %q: want int, got %T", c.Name, v)
+			}
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(n))
+		case Double:
+			f, ok := v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("parquet: column %q: want float64, got %T", c.Name, v)
+			}
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(f))
+		case String:
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("parquet: column %q: want string, got %T", c.Name, v)
+			}
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s)))
+			buf = append(buf, s...)
+		case Timestamp:
+			t, ok := v.(time.Time)
+			if !ok {
+				return nil, fmt.Errorf("parquet: column %q: want time.Time, got %T", c.Name, v)
+			}
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(t.UnixMilli()))
+		}
+	}
+	return buf, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
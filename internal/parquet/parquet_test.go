@@ -0,0 +1,326 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"math"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// decoder reads the thrift compact protocol into maps of field id to value, to check
+// the footer and page headers without a parquet library.
+type decoder struct {
+	t   *testing.T
+	buf []byte
+	pos int
+}
+
+func (d *decoder) byte() byte {
+	if d.pos >= len(d.buf) {
+		d.t.Fatalf("thrift: read past the end at %d", d.pos)
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	if n <= 0 {
+		d.t.Fatalf("thrift: bad varint at %d", d.pos)
+	}
+	d.pos += n
+	return v
+}
+
+func (d *decoder) zigzag() int64 {
+	v := d.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *decoder) value(typ byte) any {
+	switch typ {
+	case compactI32, compactI64:
+		return d.zigzag()
+	case compactBinary:
+		n := int(d.uvarint())
+		s := string(d.buf[d.pos : d.pos+n])
+		d.pos += n
+		return s
+	case compactList:
+		h := d.byte()
+		size, elem := int(h>>4), h&0x0f
+		if size == 15 {
+			size = int(d.uvarint())
+		}
+		list := make([]any, size)
+		for i := range list {
+			list[i] = d.value(elem)
+		}
+		return list
+	case compactStruct:
+		return d.structure()
+	default:
+		d.t.Fatalf("thrift: unexpected type %d at %d", typ, d.pos)
+		return nil
+	}
+}
+
+func (d *decoder) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var id int16
+	for {
+		h := d.byte()
+		if h == 0 {
+			return fields
+		}
+		if delta := int16(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(d.zigzag())
+		}
+		fields[id] = d.value(h & 0x0f)
+	}
+}
+
+// golden is the path of the file Write produces for table, rewritten by -update.
+const golden = "testdata/table.parquet"
+
+var update = flag.Bool("update", false, "rewrite "+golden)
+
+// table returns a table with a column of every type.
+func table() (columns []Column, rows [][]any) {
+	columns = []Column{
+		{"id", Int64},
+		{"score", Double},
+		{"name", String},
+		{"at", Timestamp},
+	}
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	rows = [][]any{
+		{1, 1.5, "first", at},
+		{int64(-2), -0.25, "", at.Add(time.Hour)},
+		{3, math.Pi, "ünïcode, with a comma", at.Add(-24 * time.Hour)},
+	}
+	return columns, rows
+}
+
+func TestWrite(t *testing.T) {
+	columns, rows := table()
+	var buf bytes.Buffer
+	if err := Write(&buf, columns, rows); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if string(b[:4]) != "PAR1" || string(b[len(b)-4:]) != "PAR1" {
+		t.Fatalf("missing PAR1 magic")
+	}
+	size := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	footer := &decoder{t: t, buf: b[len(b)-8-size : len(b)-8]}
+	meta := footer.structure()
+	if footer.pos != size {
+		t.Errorf("footer is %d bytes, decoded %d", size, footer.pos)
+	}
+
+	if meta[1] != int64(1) {
+		t.Errorf("version = %v, want 1", meta[1])
+	}
+	if meta[3] != int64(len(rows)) {
+		t.Errorf("num_rows = %v, want %d", meta[3], len(rows))
+	}
+	schema := meta[2].([]any)
+	if len(schema) != len(columns)+1 {
+		t.Fatalf("schema has %d elements, want %d", len(schema), len(columns)+1)
+	}
+	root := schema[0].(map[int16]any)
+	if root[4] != "schema" || root[5] != int64(len(columns)) {
+		t.Errorf("root = %v, want schema with %d children", root, len(columns))
+	}
+	converted := map[Type]any{String: int64(convertedUTF8), Timestamp: int64(convertedTimestampMillis)}
+	for i, c := range columns {
+		e := schema[i+1].(map[int16]any)
+		if e[4] != c.Name || e[1] != int64(c.Type.physical()) || e[3] != int64(repetitionRequired) || e[6] != converted[c.Type] {
+			t.Errorf("schema element %d = %v, want %+v", i+1, e, c)
+		}
+	}
+
+	groups := meta[4].([]any)
+	if len(groups) != 1 {
+		t.Fatalf("%d row groups, want 1", len(groups))
+	}
+	group := groups[0].(map[int16]any)
+	if group[3] != int64(len(rows)) {
+		t.Errorf("row group num_rows = %v, want %d", group[3], len(rows))
+	}
+	chunks := group[1].([]any)
+	if len(chunks) != len(columns) {
+		t.Fatalf("%d column chunks, want %d", len(chunks), len(columns))
+	}
+	var total int64
+	for i, c := range columns {
+		chunk := chunks[i].(map[int16]any)[3].(map[int16]any)
+		if !reflect.DeepEqual(chunk[3], []any{c.Name}) || chunk[5] != int64(len(rows)) {
+			t.Errorf("column %q: chunk = %v", c.Name, chunk)
+		}
+		offset := chunk[9].(int64)
+		page := &decoder{t: t, buf: b, pos: int(offset)}
+		header := page.structure()
+		if chunk[7] != int64(page.pos)-offset+header[3].(int64) {
+			t.Errorf("column %q: total_compressed_size = %v, want header and page size", c.Name, chunk[7])
+		}
+		total += chunk[7].(int64)
+		if dp := header[5].(map[int16]any); dp[1] != int64(len(rows)) || dp[2] != int64(encodingPlain) {
+			t.Errorf("column %q: data page header = %v", c.Name, dp)
+		}
+
+		data := b[page.pos : page.pos+int(header[3].(int64))]
+		for r, row := range rows {
+			var got, want any
+			switch c.Type {
+			case Int64:
+				got, data = int64(binary.LittleEndian.Uint64(data)), data[8:]
+				want = reflect.ValueOf(row[i]).Int()
+			case Double:
+				got, data = math.Float64frombits(binary.LittleEndian.Uint64(data)), data[8:]
+				want = row[i]
+			case String:
+				n := binary.LittleEndian.Uint32(data)
+				got, data = string(data[4:4+n]), data[4+n:]
+				want = row[i]
+			case Timestamp:
+				got, data = int64(binary.LittleEndian.Uint64(data)), data[8:]
+				want = row[i].(time.Time).UnixMilli()
+			}
+			if got != want {
+				t.Errorf("column %q row %d = %v, want %v", c.Name, r, got, want)
+			}
+		}
+		if len(data) != 0 {
+			t.Errorf("column %q: %d bytes left in the page", c.Name, len(data))
+		}
+	}
+	if group[2] != total {
+		t.Errorf("total_byte_size = %v, want %d", group[2], total)
+	}
+}
+
+func TestWriteWrongType(t *testing.T) {
+	err := Write(&bytes.Buffer{}, []Column{{"id", Int64}}, [][]any{{"one"}})
+	if err == nil {
+		t.Error("Write accepted a string for an Int64 column")
+	}
+}
+
+func TestWriteManyColumns(t *testing.T) {
+	// 15 or more list elements use the long list header
+	var columns []Column
+	var row []any
+	for i := range 20 {
+		columns = append(columns, Column{string(rune('a' + i)), Int64})
+		row = append(row, i)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, columns, [][]any{row}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	size := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	meta := (&decoder{t: t, buf: b[len(b)-8-size : len(b)-8]}).structure()
+	schema := meta[2].([]any)
+	if len(schema) != len(columns)+1 {
+		t.Fatalf("schema has %d elements, want %d", len(schema), len(columns)+1)
+	}
+	for i, c := range columns {
+		if name := schema[i+1].(map[int16]any)[4]; name != c.Name {
+			t.Errorf("schema element %d is %v, want %s", i+1, name, c.Name)
+		}
+	}
+	if chunks := meta[4].([]any)[0].(map[int16]any)[1].([]any); len(chunks) != len(columns) {
+		t.Errorf("%d column chunks, want %d", len(chunks), len(columns))
+	}
+}
+
+func TestGolden(t *testing.T) {
+	columns, rows := table()
+	var buf bytes.Buffer
+	if err := Write(&buf, columns, rows); err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Write output differs from %s; check the new output with TestReaders and rerun with -update", golden)
+	}
+}
+
+// TestReaders reads the golden file with pyarrow and DuckDB, the readers exports are
+// loaded with, skipping those that aren't installed. Both print the rows as JSON, with
+// timestamps as milliseconds.
+func TestReaders(t *testing.T) {
+	readers := []struct {
+		name  string
+		check []string
+		read  []string
+	}{
+		{"pyarrow", []string{"python3", "-c", "import pyarrow"}, []string{"python3", "-c", `
+import json, sys, pyarrow.parquet as pq
+t = pq.read_table(sys.argv[1])
+t = t.set_column(3, "at", t.column("at").cast("int64"))
+print(json.dumps(t.to_pylist()))
+`, golden}},
+		{"duckdb", []string{"duckdb", "-c", "select 1"}, []string{"duckdb", "-json", "-c",
+			"select id, score, name, epoch_ms(at) as at from read_parquet('" + golden + "')"}},
+	}
+
+	columns, rows := table()
+	var want []map[string]any
+	for _, row := range rows {
+		r := make(map[string]any)
+		for i, c := range columns {
+			r[c.Name] = row[i]
+			if at, ok := row[i].(time.Time); ok {
+				r[c.Name] = at.UnixMilli()
+			}
+		}
+		want = append(want, r)
+	}
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &want); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range readers {
+		t.Run(r.name, func(t *testing.T) {
+			if err := exec.Command(r.check[0], r.check[1:]...).Run(); err != nil {
+				t.Skipf("%s isn't installed: %v", r.name, err)
+			}
+			out, err := exec.Command(r.read[0], r.read[1:]...).Output()
+			if err != nil {
+				t.Fatalf("%s can't read %s: %v", r.name, golden, err)
+			}
+			var got []map[string]any
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("%s: %v: %s", r.name, err, out)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s read %v, want %v", r.name, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package parquet
+
+import "encoding/binary"
+
+// compact protocol field and element types.
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// thrift encodes structs with the thrift compact protocol, which parquet uses for
+// its page headers and file metadata. Fields must be written in increasing id order.
+type thrift struct {
+	buf []byte
+	// last is the id of the previous field of each open struct.
+	last []int16
+	id   int16
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	if delta := id - t.id; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.varint(int64(id))
+	}
+	t.id = id
+}
+
+// varint appends n zigzag varint encoded.
+func (t *thrift) varint(n int64) {
+	t.buf = binary.AppendUvarint(t.buf, uint64((n<<1)^(n>>63)))
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, compactI32)
+	t.varint(int64(v))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, compactI64)
+	t.varint(v)
+}
+
+func (t *thrift) binary(id int16, s string) {
+	t.field(id, compactBinary)
+	t.rawString(s)
+}
+
+// rawString appends a length prefixed string without a field header, for list elements.
+func (t *thrift) rawString(s string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+// raw appends already encoded bytes, such as a struct list element.
+func (t *thrift) raw(b []byte) {
+	t.buf = append(t.buf, b...)
+}
+
+func (t *thrift) listBegin(id int16, elem byte, size int) {
+	t.field(id, compactList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elem)
+	} else {
+		t.buf = append(t.buf, 0xf0|elem)
+		t.buf = binary.AppendUvarint(t.buf, uint64(size))
+	}
+}
+
+// structBegin starts a struct valued field.
+func (t *thrift) structBegin(id int16) {
+	t.field(id, compactStruct)
+	t.elemBegin()
+}
+
+func (t *thrift) structEnd() {
+	t.elemEnd()
+}
+
+// elemBegin starts a struct that is a list element, it has no field header.
+func (t *thrift) elemBegin() {
+	t.last = append(t.last, t.id)
+	t.id = 0
+}
+
+func (t *thrift) elemEnd() {
+	t.stop()
+	t.id = t.last[len(t.last)-1]
+	t.last = t.last[:len(t.last)-1]
+}
+
+// stop ends the current struct.
+func (t *thrift) stop() {
+	t.buf = append(t.buf, 0)
+}
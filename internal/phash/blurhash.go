@@ -0,0 +1,100 @@
+package phash
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash is a decoded blurhash: the average color of an image and the
+// coefficients of a few of its lowest frequencies.
+type Blurhash struct {
+	X, Y int
+	// Components are the linear RGB coefficients of frequency (i, j) at j*X+i, the
+	// average color first.
+	Components [][3]float64
+}
+
+// ParseBlurhash decodes a blurhash string, see https://blurha.sh.
+func ParseBlurhash(s string) (*Blurhash, error) {
+	if len(s) < 6 {
+		return nil, errors.New("blurhash: too short")
+	}
+	size, err := decode83(s[:1])
+	if err != nil {
+		return nil, err
+	}
+	b := &Blurhash{X: size%9 + 1, Y: size/9 + 1}
+	if len(s) != 4+2*b.X*b.Y {
+		return nil, errors.New("blurhash: invalid length")
+	}
+	quantisedMax, err := decode83(s[1:2])
+	if err != nil {
+		return nil, err
+	}
+	maxAC := float64(quantisedMax+1) / 166
+
+	dc, err := decode83(s[2:6])
+	if err != nil {
+		return nil, err
+	}
+	b.Components = append(b.Components, [3]float64{
+		srgbToLinear(dc >> 16),
+		srgbToLinear(dc >> 8 & 255),
+		srgbToLinear(dc & 255),
+	})
+	for i := 1; i < b.X*b.Y; i++ {
+		ac, err := decode83(s[4+2*i : 6+2*i])
+		if err != nil {
+			return nil, err
+		}
+		b.Components = append(b.Components, [3]float64{
+			signPow((float64(ac/(19*19))-9)/9, 2) * maxAC,
+			signPow((float64(ac/19%19)-9)/9, 2) * maxAC,
+			signPow((float64(ac%19)-9)/9, 2) * maxAC,
+		})
+	}
+	return b, nil
+}
+
+// BlurhashDistance returns the euclidean distance between the frequencies that a
+// and b have in common. Images that look alike have a small distance, but so may
+// images that merely share a palette and composition.
+func BlurhashDistance(a, b *Blurhash) float64 {
+	var sum float64
+	for j := range min(a.Y, b.Y) {
+		for i := range min(a.X, b.X) {
+			ca, cb := a.Components[j*a.X+i], b.Components[j*b.X+i]
+			for k := range 3 {
+				sum += (ca[k] - cb[k]) * (ca[k] - cb[k])
+			}
+		}
+	}
+	return math.Sqrt(sum)
+}
+
+func decode83(s string) (int, error) {
+	var v int
+	for _, c := range s {
+		i := strings.IndexRune(base83, c)
+		if i < 0 {
+			return 0, errors.New("blurhash: invalid character")
+		}
+		v = v*83 + i
+	}
+	return v, nil
+}
+
+func srgbToLinear(v int) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
@@ -0,0 +1,109 @@
+// package phash computes perceptual hashes of images, which are close in Hamming
+// distance for images that look alike even if they were resized or recompressed.
+package phash
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// Hash is a 64 bit perceptual hash.
+type Hash uint64
+
+// Distance returns the number of bits in which a and b differ.
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// DHash returns the difference hash of img: whether each pixel of a 9x8 grayscale
+// thumbnail is brighter than its right neighbour.
+func DHash(img image.Image) Hash {
+	g := grayscale(img, 9, 8)
+	var h Hash
+	for y := range 8 {
+		for x := range 8 {
+			h <<= 1
+			if g[y*9+x] > g[y*9+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// PHash returns the DCT hash of img: whether each of the 8x8 lowest frequencies of
+// the discrete cosine transform of a 32x32 grayscale thumbnail, except the first,
+// is above their median. The first is the average brightness, so the 63 others fill
+// the low bits and the top bit is always 0.
+func PHash(img image.Image) Hash {
+	const n, low = 32, 8
+	g := grayscale(img, n, n)
+	// 2D DCT-II of the low frequencies only, rows then columns
+	var rows [n][low]float64
+	for y := range n {
+		for u := range low {
+			var sum float64
+			for x := range n {
+				sum += g[y*n+x] * dctCos[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+	coeffs := make([]float64, 0, low*low)
+	for v := range low {
+		for u := range low {
+			var sum float64
+			for y := range n {
+				sum += rows[y][u] * dctCos[v][y]
+			}
+			coeffs = append(coeffs, sum)
+		}
+	}
+	coeffs = coeffs[1:]
+	sorted := slices.Clone(coeffs)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+	var h Hash
+	for _, c := range coeffs {
+		h <<= 1
+		if c > median {
+			h |= 1
+		}
+	}
+	return h
+}
+
+// dctCos[u][x] is cos((2x+1)uπ/64).
+var dctCos = func() (c [8][32]float64) {
+	for u := range 8 {
+		for x := range 32 {
+			c[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / 64)
+		}
+	}
+	return c
+}()
+
+// grayscale scales img to w x h pixels, averaging the source pixels that fall into
+// each one, and returns their luma row by row.
+func grayscale(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	g := make([]float64, w*h)
+	for y := range h {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := range w {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			var sum, n float64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					r, gg, bb, _ := img.At(sx, sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(gg) + 0.114*float64(bb)
+					n++
+				}
+			}
+			g[y*w+x] = sum / n
+		}
+	}
+	return g
+}
@@ -0,0 +1,130 @@
+package phash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+// threshold is the default images dedupe --threshold.
+const threshold = 8
+
+// pattern draws a w x h image of smooth waves and a disc, f varying the waves.
+func pattern(w, h int, f float64) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			u, v := float64(x)/float64(w), float64(y)/float64(h)
+			l := 0.5 + 0.25*math.Sin(f*u*2*math.Pi) + 0.25*math.Cos(f*0.7*v*2*math.Pi)
+			if (u-0.3)*(u-0.3)+(v-0.6)*(v-0.6) < 0.04 {
+				l = 1 - l
+			}
+			c := uint8(l * 255)
+			img.Set(x, y, color.RGBA{c, uint8(float64(c) * 0.8), 255 - c, 255})
+		}
+	}
+	return img
+}
+
+// resize scales img to w x h, nearest neighbour.
+func resize(img image.Image, w, h int) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			dst.Set(x, y, img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	return dst
+}
+
+// reencode compresses img as a low quality JPEG.
+func reencode(t *testing.T, img image.Image) image.Image {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 40}); err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestHashes(t *testing.T) {
+	orig := pattern(512, 768, 3)
+	alike := map[string]image.Image{
+		"resized":   resize(orig, 200, 300),
+		"reencoded": reencode(t, orig),
+		"both":      reencode(t, resize(orig, 333, 500)),
+	}
+	different := map[string]image.Image{
+		"other waves": pattern(512, 768, 5),
+		"cropped":     orig.(*image.RGBA).SubImage(image.Rect(0, 384, 512, 768)),
+	}
+	for name, hash := range map[string]func(image.Image) Hash{"DHash": DHash, "PHash": PHash} {
+		h := hash(orig)
+		for what, img := range alike {
+			if d := Distance(h, hash(img)); d > threshold {
+				t.Errorf("%s: %s image is %d bits away, want at most %d", name, what, d, threshold)
+			}
+		}
+		for what, img := range different {
+			if d := Distance(h, hash(img)); d <= threshold {
+				t.Errorf("%s: %s image is %d bits away, want more than %d", name, what, d, threshold)
+			}
+		}
+	}
+}
+
+func TestPHashSkipsAverage(t *testing.T) {
+	orig := pattern(256, 256, 3)
+	if h := PHash(orig); h>>63 != 0 {
+		t.Errorf("PHash = %064b, want the top bit 0", h)
+	}
+	// brightening every pixel only changes the average
+	bright := image.NewRGBA(orig.Bounds())
+	for y := range 256 {
+		for x := range 256 {
+			r, g, b, _ := orig.At(x, y).RGBA()
+			bright.Set(x, y, color.RGBA{uint8(min(r>>8+20, 255)), uint8(min(g>>8+20, 255)), uint8(min(b>>8+20, 255)), 255})
+		}
+	}
+	if d := Distance(PHash(orig), PHash(bright)); d > 2 {
+		t.Errorf("brightened image is %d bits away", d)
+	}
+}
+
+func TestParseBlurhash(t *testing.T) {
+	// the example of https://blurha.sh
+	b, err := ParseBlurhash("LEHV6nWB2yk8pyo0adR*.7kCMdnj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.X != 4 || b.Y != 3 || len(b.Components) != 12 {
+		t.Fatalf("got %dx%d with %d components, want 4x3 with 12", b.X, b.Y, len(b.Components))
+	}
+	// HV6n is the average color #979695
+	if want := [3]float64{srgbToLinear(0x97), srgbToLinear(0x96), srgbToLinear(0x95)}; b.Components[0] != want {
+		t.Errorf("average = %v, want %v", b.Components[0], want)
+	}
+	// E is a maximum of 15/166, WB quantises every channel to 7 of 19
+	want := -math.Pow(2.0/9, 2) * 15 / 166
+	for k, c := range b.Components[1] {
+		if math.Abs(c-want) > 1e-12 {
+			t.Errorf("component 1 channel %d = %g, want %g", k, c, want)
+		}
+	}
+	if d := BlurhashDistance(b, b); d != 0 {
+		t.Errorf("distance to itself = %g", d)
+	}
+
+	for _, s := range []string{"", "LEHV6nWB2yk8pyo0adR*.7kCMdn", "LEHV6nWB2yk8pyo0adR*.7kCMdn\""} {
+		if _, err := ParseBlurhash(s); err == nil {
+			t.Errorf("ParseBlurhash(%q) succeeded", s)
+		}
+	}
+}
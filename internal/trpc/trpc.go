@@ -3,6 +3,7 @@ package trpc
 import (
 	"context"
 	"fmt"
+	"iter"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -79,6 +80,23 @@ func (i *CursorIterator[T]) Err() error {
 	return i.err
 }
 
+// All returns a range-over-func iterator over the remaining items.
+// Pages are fetched lazily, so breaking out of the loop stops further requests.
+// If a request fails the error is yielded once, with the zero value, and iteration stops.
+func (i *CursorIterator[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for i.Next() {
+			if !yield(i.Item(), nil) {
+				return
+			}
+		}
+		if err := i.Err(); err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
+
 // New creates a new Civit TRCP API client.
 func New(token string, cookiesfile string) *Client {
 	jar := cookiejar.NewPersistentJar(
@@ -92,20 +110,82 @@ func New(token string, cookiesfile string) *Client {
 	return &Client{client: &client}
 }
 
-// GeneratedItem is a generated image.
+// GeneratedItem is a generation workflow: one or more steps, each producing images.
 type GeneratedItem struct {
 	ID        string    `json:"id"`
 	CreatedAt time.Time `json:"createdAt"`
-	Steps     []struct {
-		Images []struct {
-			Type      string    `json:"type"`
-			ID        string    `json:"id"`
-			Completed time.Time `json:"completed"`
-			URL       string    `json:"url"`
-			Widht     int       `json:"width"`
-			Height    int       `json:"height"`
-		} `json:"images"`
-	} `json:"steps"`
+	// Status is the status of the workflow: unassigned, preparing, scheduled,
+	// processing, succeeded, failed, expired or canceled.
+	Status string `json:"status"`
+	// TotalCost is the buzz charged for the workflow.
+	TotalCost float64          `json:"totalCost"`
+	Tags      []string         `json:"tags"`
+	Steps     []GenerationStep `json:"steps"`
+}
+
+// Images returns the images of every step.
+func (g *GeneratedItem) Images() []GeneratedImage {
+	var images []GeneratedImage
+	for _, step := range g.Steps {
+		images = append(images, step.Images...)
+	}
+	return images
+}
+
+// GenerationStep is a step of a generation workflow.
+type GenerationStep struct {
+	// Type is the kind of step, such as textToImage, imageGen, comfy or videoGen.
+	Type        string               `json:"$type"`
+	Name        string               `json:"name"`
+	Status      string               `json:"status"`
+	CompletedAt *time.Time           `json:"completedAt"`
+	Params      GenerationParams     `json:"params"`
+	Resources   []GenerationResource `json:"resources"`
+	Images      []GeneratedImage     `json:"images"`
+	Errors      []string             `json:"errors"`
+}
+
+// GenerationParams are the parameters of a step.
+type GenerationParams struct {
+	Prompt         string  `json:"prompt"`
+	NegativePrompt string  `json:"negativePrompt"`
+	BaseModel      string  `json:"baseModel"`
+	Workflow       string  `json:"workflow,omitempty"`
+	Sampler        string  `json:"sampler,omitempty"`
+	Seed           *int64  `json:"seed,omitempty"`
+	Steps          int     `json:"steps,omitempty"`
+	CFGScale       float64 `json:"cfgScale,omitempty"`
+	ClipSkip       int     `json:"clipSkip,omitempty"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	Quantity       int     `json:"quantity"`
+	Draft          bool    `json:"draft,omitempty"`
+}
+
+// GenerationResource is a model version used by a step.
+type GenerationResource struct {
+	// ID is the model version id.
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	BaseModel string   `json:"baseModel"`
+	Strength  *float64 `json:"strength,omitempty"`
+	Model     struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"model"`
+}
+
+// GeneratedImage is an image produced by a step.
+type GeneratedImage struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	Seed      int64     `json:"seed"`
+	Completed time.Time `json:"completed"`
+	URL       string    `json:"url"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
 }
 
 func (c *Client) QueryGeneratedImages(ctx context.Context) *CursorIterator[GeneratedItem] {
@@ -121,6 +201,57 @@ func (c *Client) QueryGeneratedImages(ctx context.Context) *CursorIterator[Gener
 	return iter
 }
 
+// GenerateImageRequest is a text to image request. Resources only need their ID
+// and Strength.
+type GenerateImageRequest struct {
+	Params    GenerationParams     `json:"params"`
+	Resources []GenerationResource `json:"resources"`
+}
+
+// GenerateImage submits a generation request and returns the queued workflow.
+func (c *Client) GenerateImage(ctx context.Context, req *GenerateImageRequest) (*GeneratedItem, error) {
+	var response struct {
+		Result struct {
+			Data struct {
+				GeneratedItem `json:"json"`
+			} `json:"data"`
+		} `json:"result"`
+	}
+	resources := make([]map[string]any, 0, len(req.Resources))
+	for _, r := range req.Resources {
+		resource := map[string]any{"id": r.ID}
+		if r.Strength != nil {
+			resource["strength"] = *r.Strength
+		}
+		resources = append(resources, resource)
+	}
+	err := requests.URL("https://civitai.com/api/trpc/orchestrator.generateImage").Client(c.client).BodyJSON(map[string]any{
+		"json": map[string]any{
+			"params":    req.Params,
+			"resources": resources,
+			"tags":      []string{"gen"},
+			"authed":    true,
+		}}).ToJSON(&response).Fetch(ctx)
+	return &response.Result.Data.GeneratedItem, err
+}
+
+// GeneratedWorkflow returns the workflow with the given id, created at or after
+// since. Generations are listed newest first, so the search stops at since.
+func (c *Client) GeneratedWorkflow(ctx context.Context, id string, since time.Time) (*GeneratedItem, error) {
+	for g, err := range c.QueryGeneratedImages(ctx).All() {
+		if err != nil {
+			return nil, err
+		}
+		if g.ID == id {
+			return &g, nil
+		}
+		if g.CreatedAt.Before(since) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("workflow %s not found", id)
+}
+
 type Item struct {
 	ID       int    `json:"id"`
 	Index    int    `json:"index"`
@@ -219,6 +350,30 @@ func (c *Client) Image(ctx context.Context, id int) (*Item, error) {
 	return &response.Result.Data.Item, requests.URL(url).Client(c.client).ToJSON(&response).Fetch(ctx)
 }
 
+// Tag is a tag voted onto an image.
+type Tag struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Score int    `json:"score"`
+}
+
+// ImageTags returns the tags of an image.
+func (c *Client) ImageTags(ctx context.Context, id int) ([]Tag, error) {
+	var response struct {
+		Result struct {
+			Data struct {
+				Tags []Tag `json:"json"`
+			} `json:"data"`
+		} `json:"result"`
+	}
+	url := fmt.Sprintf("https://civitai.com/api/trpc/tag.getVotableTags?input=%s", url.QueryEscape(fmt.Sprintf(`{"json":{"id":%d,"type":"image","authed":true}}`, id)))
+	if err := requests.URL(url).Client(c.client).ToJSON(&response).Fetch(ctx); err != nil {
+		return nil, err
+	}
+	return response.Result.Data.Tags, nil
+}
+
 type Model struct {
 	ID            int    `json:"id"`
 	Name          string `json:"name"`
@@ -257,6 +412,12 @@ type CompensationPool struct {
 		// Forecasted is the forecasted size of banked buzz.
 		Forecasted float64 `json:"forecasted"`
 	} `json:"size"`
+	Phases struct {
+		// Bank is the start and end of the window in which buzz can be banked.
+		Bank [2]time.Time `json:"bank"`
+		// Extraction is the start and end of the window in which banked buzz can be extracted.
+		Extraction [2]time.Time `json:"extraction"`
+	} `json:"phases"`
 }
 
 func (c *Client) CreatorProgramGetCompensationPool(ctx context.Context) (*CompensationPool, error) {
@@ -271,6 +432,125 @@ func (c *Client) CreatorProgramGetCompensationPool(ctx context.Context) (*Compen
 	return &response.Result.Data.CompensationPool, requests.URL(url).Client(c.client).ToJSON(&response).Fetch(ctx)
 }
 
+// Banked is the current user's banked buzz for this month.
+type Banked struct {
+	// Total is the amount of buzz banked this month.
+	Total float64 `json:"total"`
+	Cap   struct {
+		// Cap is the maximum amount of buzz that can be banked this month.
+		Cap         float64 `json:"cap"`
+		PeakEarning struct {
+			Month  time.Time `json:"month"`
+			Earned float64   `json:"earned"`
+		} `json:"peakEarning"`
+	} `json:"cap"`
+}
+
+func (c *Client) CreatorProgramGetBanked(ctx context.Context) (*Banked, error) {
+	var response struct {
+		Result struct {
+			Data struct {
+				Banked `json:"json"`
+			} `json:"data"`
+		} `json:"result"`
+	}
+	url := fmt.Sprintf("https://civitai.com/api/trpc/creatorProgram.getBanked?input=%s", url.QueryEscape(`{"json":{"authed":true}}`))
+	return &response.Result.Data.Banked, requests.URL(url).Client(c.client).ToJSON(&response).Fetch(ctx)
+}
+
+// CreatorProgramBankBuzz moves amount buzz from the user's account into the compensation pool.
+func (c *Client) CreatorProgramBankBuzz(ctx context.Context, amount int) error {
+	return requests.URL("https://civitai.com/api/trpc/creatorProgram.bankBuzz").Client(c.client).BodyJSON(map[string]any{
+		"json": map[string]any{
+			"amount": amount,
+			"authed": true,
+		}}).Post().Fetch(ctx)
+}
+
+// CreatorProgramExtractBuzz returns all of this month's banked buzz to the user's account.
+func (c *Client) CreatorProgramExtractBuzz(ctx context.Context) error {
+	return requests.URL("https://civitai.com/api/trpc/creatorProgram.extractBuzz").Client(c.client).BodyJSON(map[string]any{
+		"json": map[string]any{
+			"authed": true,
+		}}).Post().Fetch(ctx)
+}
+
+// BuzzAccount is the current user's buzz wallet.
+type BuzzAccount struct {
+	ID              int `json:"id"`
+	Balance         int `json:"balance"`
+	LifetimeBalance int `json:"lifetimeBalance"`
+}
+
+func (c *Client) BuzzGetUserAccount(ctx context.Context) (*BuzzAccount, error) {
+	var response struct {
+		Result struct {
+			Data struct {
+				BuzzAccount `json:"json"`
+			} `json:"data"`
+		} `json:"result"`
+	}
+	url := fmt.Sprintf("https://civitai.com/api/trpc/buzz.getUserAccount?input=%s", url.QueryEscape(`{"json":{"authed":true}}`))
+	return &response.Result.Data.BuzzAccount, requests.URL(url).Client(c.client).ToJSON(&response).Fetch(ctx)
+}
+
+// Transaction is a movement of buzz between two accounts.
+type Transaction struct {
+	Date          time.Time `json:"date"`
+	Type          string    `json:"type"`
+	FromAccountID int       `json:"fromAccountId"`
+	ToAccountID   int       `json:"toAccountId"`
+	Amount        int       `json:"amount"`
+	Description   string    `json:"description"`
+	FromUser      *User     `json:"fromUser"`
+	ToUser        *User     `json:"toUser"`
+}
+
+// transactionsResult is a page of buzz.getUserTransactions. Unlike the cursor
+// procedures, it pages by the date of the last transaction, serialized by superjson.
+type transactionsResult struct {
+	Result struct {
+		Data struct {
+			JSON struct {
+				Cursor       *time.Time    `json:"cursor"`
+				Transactions []Transaction `json:"transactions"`
+			} `json:"json"`
+		} `json:"data"`
+	} `json:"result"`
+}
+
+// BuzzTransactions returns the current user's buzz transactions, newest first.
+// Pages are fetched lazily, if a request fails the error is yielded once and
+// iteration stops.
+func (c *Client) BuzzTransactions(ctx context.Context) iter.Seq2[Transaction, error] {
+	return func(yield func(Transaction, error) bool) {
+		var cursor *time.Time
+		for {
+			input := `{"json":{"limit":200,"cursor":null,"authed":true},"meta":{"values":{"cursor":["undefined"]}}}`
+			if cursor != nil {
+				input = fmt.Sprintf(`{"json":{"limit":200,"cursor":%q,"authed":true},"meta":{"values":{"cursor":["Date"]}}}`,
+					cursor.UTC().Format("2006-01-02T15:04:05.000Z"))
+			}
+			var response transactionsResult
+			url := fmt.Sprintf("https://civitai.com/api/trpc/buzz.getUserTransactions?input=%s", url.QueryEscape(input))
+			if err := requests.URL(url).Client(c.client).ToJSON(&response).Fetch(ctx); err != nil {
+				yield(Transaction{}, err)
+				return
+			}
+			page := response.Result.Data.JSON
+			for _, t := range page.Transactions {
+				if !yield(t, nil) {
+					return
+				}
+			}
+			if page.Cursor == nil || len(page.Transactions) == 0 || (cursor != nil && !page.Cursor.Before(*cursor)) {
+				return
+			}
+			cursor = page.Cursor
+		}
+	}
+}
+
 type Result[T any] struct {
 	Data struct {
 		JSON []T `json:"json"`
@@ -0,0 +1,66 @@
+package trpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// roundTripper answers every request with the JSON body it returns.
+type roundTripper func(*http.Request) string
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(f(r))),
+		Request:    r,
+	}, nil
+}
+
+func TestBuzzTransactions(t *testing.T) {
+	pages := map[string]string{
+		"": `{"result":{"data":{"json":{"cursor":"2024-05-01T10:00:00.000Z","transactions":[
+			{"date":"2024-05-02T10:00:00.000Z","type":"tip","fromAccountId":1,"toAccountId":2,"amount":100,"description":"thanks"},
+			{"date":"2024-05-01T10:00:00.000Z","type":"generation","fromAccountId":2,"toAccountId":0,"amount":20}
+		]},"meta":{"values":{"cursor":["Date"],"transactions.0.date":["Date"],"transactions.1.date":["Date"]}}}}}`,
+		"2024-05-01T10:00:00.000Z": `{"result":{"data":{"json":{"transactions":[
+			{"date":"2024-04-30T10:00:00.000Z","type":"reward","fromAccountId":0,"toAccountId":2,"amount":5}
+		]},"meta":{"values":{"transactions.0.date":["Date"]}}}}}`,
+	}
+	var cursors []string
+	c := &Client{client: &http.Client{Transport: roundTripper(func(r *http.Request) string {
+		var input struct {
+			JSON struct {
+				Cursor *string `json:"cursor"`
+			} `json:"json"`
+		}
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("input")), &input); err != nil {
+			t.Fatal(err)
+		}
+		var cursor string
+		if input.JSON.Cursor != nil {
+			cursor = *input.JSON.Cursor
+		}
+		cursors = append(cursors, cursor)
+		return pages[cursor]
+	})}}
+
+	var amounts []int
+	for tx, err := range c.BuzzTransactions(context.Background()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		amounts = append(amounts, tx.Amount)
+	}
+	if want := []int{100, 20, 5}; !slices.Equal(amounts, want) {
+		t.Errorf("amounts = %v, want %v", amounts, want)
+	}
+	if want := []string{"", "2024-05-01T10:00:00.000Z"}; !slices.Equal(cursors, want) {
+		t.Errorf("cursors = %q, want %q", cursors, want)
+	}
+}
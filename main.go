@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"net/http"
 	"os"
 	"path/filepath"
 	"slices"
@@ -17,16 +18,23 @@ import (
 	"github.com/alecthomas/kong"
 	"github.com/carlmjohnson/requests"
 	"github.com/d00918380/civit/internal/algorithms"
+	"github.com/d00918380/civit/internal/civit"
 	"github.com/d00918380/civit/internal/trpc"
 )
 
 var CLI struct {
 	APIKey  string `env:"CIVIT_API_KEY" help:"API key." required:""`
 	Cookies string `help:"Path to the cookies file." default:"cookies.json"`
+	TZ      string `help:"Time zone for dates and hours in reports and exports." default:"Local"`
 	Posts   struct {
 		Download struct {
 			Ids []int `arg:"" name:"id" help:"Post IDs to download."`
 		} `cmd:"" help:"Download posts."`
+		Analyze struct {
+			Input    string        `arg:"" name:"input" help:"Input file." type:"existingfile"`
+			MinAge   time.Duration `help:"Ignore posts younger than this, their score is still growing." default:"72h"`
+			MinPosts int           `help:"Number of posts a size needs to be the best size." default:"3"`
+		} `cmd:"" help:"Analyze scores by image position and post size."`
 	} `cmd:"" help:"Manage posts."`
 	Users struct {
 		Following struct {
@@ -43,20 +51,162 @@ var CLI struct {
 	} `cmd:"" help:"Manage user."`
 	Images struct {
 		Metadata struct {
-			Username string `arg:"" name:"username" help:"Username to get metadata for."`
-			Id       int    `arg:"" name:"id" help:"User ID to get metadata for."`
+			Username string        `arg:"" name:"username" help:"Username to get metadata for."`
+			Id       int           `arg:"" name:"id" help:"User ID to get metadata for."`
+			Limit    int           `help:"Only fetch the newest N images, 0 for all."`
+			Since    string        `help:"Previous dump to update incrementally; only new images and those inside the refresh window are fetched." type:"existingfile"`
+			Refresh  time.Duration `help:"Window of recent images whose stats are refreshed when using --since." default:"720h"`
 		} `cmd:"" help:"Get metadata for users."`
+		Refresh struct {
+			Input       string        `arg:"" name:"input" help:"Dump to refresh." type:"existingfile"`
+			Output      string        `help:"Where to write the refreshed dump, defaults to overwriting the input."`
+			History     string        `help:"CSV file to append a row per refreshed image to." default:"images_history.csv"`
+			Window      time.Duration `help:"Only refresh images published within this window." default:"720h"`
+			Concurrency int           `help:"Number of concurrent requests." default:"4"`
+			Interval    time.Duration `help:"Minimum delay between requests." default:"250ms"`
+		} `cmd:"" help:"Refresh stats of images in an existing dump."`
+		Significance struct {
+			Input     string     `arg:"" name:"input" help:"Input file." type:"existingfile"`
+			Metric    string     `help:"Compare the score of every image or the efficiency of every post." enum:"score,efficiency" default:"score"`
+			A         groupFlags `embed:"" prefix:"a-" group:"Group A"`
+			B         groupFlags `embed:"" prefix:"b-" group:"Group B"`
+			Meta      string     `help:"Metadata written by images meta, read when a group selects tags." default:"images_meta.json"`
+			Resamples int        `help:"Number of bootstrap resamples." default:"2000"`
+		} `cmd:"" help:"Test whether two groups of images or posts differ significantly."`
+		Meta struct {
+			Username string        `arg:"" name:"username" help:"Username to archive the metadata of."`
+			Output   string        `help:"File to write, existing tags are kept and only fetched for new images." default:"images_meta.json"`
+			Interval time.Duration `help:"Minimum delay between tag requests." default:"250ms"`
+			Refetch  time.Duration `help:"Fetch the tags of images younger than this again, they're still being voted on." default:"72h"`
+		} `cmd:"" help:"Archive generation metadata and tags of images."`
+		Dedupe struct {
+			Input            string  `arg:"" name:"input" help:"Input file, to find the score of downloaded images." type:"existingfile"`
+			Downloads        string  `help:"Directory containing the posts/ and generated/ trees." default:"." type:"existingdir"`
+			Generated        bool    `help:"Include generated images, not only published ones. Every published image is then read, the blurhash prefilter only skips pairs of published images."`
+			Threshold        int     `help:"Largest Hamming distance of both the dHash and the pHash of near-duplicates." default:"8"`
+			BlurhashDistance float64 `help:"Don't compare published images whose blurhashes are further apart, 0 to compare all." default:"0.3"`
+		} `cmd:"" help:"Find near-duplicate downloaded images by perceptual hash."`
+		Anomalies struct {
+			Input     string        `arg:"" name:"input" help:"Input file." type:"existingfile"`
+			Threshold float64       `help:"Robust z-score beyond which an image is an anomaly." default:"3"`
+			MinAge    time.Duration `help:"Ignore images younger than this, their score is still growing." default:"24h"`
+			Since     time.Duration `help:"Only list anomalies published within this window, 0 for all."`
+		} `cmd:"" help:"List images scoring far above or below expectation for their age, post size and hour."`
 	} `cmd:"" help:"Manage images."`
 	Orchestrator struct {
 		Download struct {
 		} `cmd:"" help:"Download all images in the orchestrator."`
+		List struct {
+			From   string   `help:"Only list generations created on or after this date (YYYY-MM-DD in --tz)."`
+			To     string   `help:"Only list generations created before this date (YYYY-MM-DD in --tz)."`
+			Status []string `help:"Only list generations with these statuses, such as succeeded, failed or processing."`
+			Model  string   `help:"Only list generations whose base model or resource names contain this, or using this model version id."`
+			Format string   `help:"Output format." enum:"text,json" default:"text"`
+		} `cmd:"" help:"List generations with their parameters, status and cost."`
+		Generate struct {
+			Recipe   string        `arg:"" name:"recipe" help:"Recipe in YAML or JSON." type:"existingfile"`
+			Interval time.Duration `help:"Delay between polls of a job's status." default:"5s"`
+			Timeout  time.Duration `help:"How long to wait for each job to finish." default:"10m"`
+			DryRun   bool          `help:"List the jobs of the recipe without submitting them."`
+			Yes      bool          `help:"Submit the jobs without asking for confirmation." short:"y"`
+		} `cmd:"" help:"Generate images from a recipe, one job per combination of its sweeps, and download them."`
+		Triage struct {
+			Input     string        `arg:"" name:"input" help:"Input file with the published images." type:"existingfile"`
+			Downloads string        `help:"Directory containing the posts/ and generated/ trees." default:"." type:"existingdir"`
+			Threshold int           `help:"Largest Hamming distance of both the dHash and the pHash of a generation and a published image." default:"8"`
+			Window    time.Duration `help:"How long after generating an image it may be published, to match images that weren't downloaded by dimensions." default:"168h"`
+		} `cmd:"" help:"Match downloaded generations to published images and report the publish rate."`
 	} `cmd:"" help:"Manage orchestrator."`
 	Report struct {
-		Input string `arg:"" name:"input" help:"Input file."`
-	} `cmd:"" help:"Generate a report."`
+		Render struct {
+			Input      string `arg:"" name:"input" help:"Input file."`
+			Definition string `help:"Report definition in YAML or JSON listing the sections to render, defaults to the built in layout." type:"existingfile"`
+			Template   string `help:"Template to render instead of the built in report.html. Files ending in .html use html/template, others text/template." type:"existingfile"`
+			Offline    bool   `help:"Render a self contained report without external scripts, with thumbnails of downloaded images."`
+			Downloads  string `help:"Directory containing the posts/ tree of downloaded images, for --offline thumbnails." default:"." type:"existingdir"`
+			Thumbnail  int    `help:"Longest side of --offline thumbnails in pixels." default:"160"`
+			Meta       string `help:"Metadata written by images meta, for resources sections." type:"existingfile"`
+		} `cmd:"" default:"withargs" help:"Generate a report."`
+		Resources struct {
+			Input     string `arg:"" name:"input" help:"Input file." type:"existingfile"`
+			Meta      string `help:"Metadata written by images meta." default:"images_meta.json" type:"existingfile"`
+			MinImages int    `help:"Leave out base models, resources and tags used by fewer images." default:"3"`
+		} `cmd:"" help:"Break down scores by base model, resource and tag."`
+		Prompts struct {
+			Input     string `arg:"" name:"input" help:"Input file." type:"existingfile"`
+			Meta      string `help:"Metadata written by images meta." default:"images_meta.json" type:"existingfile"`
+			MinImages int    `help:"Leave out terms used by fewer images." default:"5"`
+		} `cmd:"" help:"Write prompt terms ranked by their correlation with score as CSV."`
+		Compare struct {
+			Inputs []string `arg:"" name:"input" help:"Dumps of the creators to compare." type:"existingfile"`
+			Days   int      `help:"Only compare images published in the last N days, 0 for all." default:"90"`
+		} `cmd:"" help:"Compare several creators side by side."`
+	} `cmd:"" help:"Generate reports."`
+	Serve struct {
+		Input      string `arg:"" name:"input" help:"Input file, reread on every request." type:"existingfile"`
+		Addr       string `help:"Address to listen on." default:"localhost:8080"`
+		Definition string `help:"Report definition in YAML or JSON listing the sections to render, defaults to the built in layout." type:"existingfile"`
+		Template   string `help:"Template to render instead of the built in report.html." type:"existingfile"`
+		Reactions  string `help:"images.csv written by reactions, served as the reactions history." default:"images.csv"`
+		Downloads  string `help:"Directory containing the posts/ tree of downloaded images, inlined as thumbnails if set." type:"existingdir"`
+		Thumbnail  int    `help:"Longest side of thumbnails in pixels." default:"160"`
+	} `cmd:"" help:"Serve the report and a JSON API over HTTP."`
+	Models struct {
+		Report struct {
+			Inputs []string `arg:"" name:"input" help:"Model csv files written by reactions." type:"existingfile"`
+		} `cmd:"" help:"Generate a model performance dashboard."`
+	} `cmd:"" help:"Manage tracked models."`
+	Compensation struct {
+		History struct {
+			Input string `arg:"" name:"input" help:"compensation.csv written by reactions." type:"existingfile"`
+		} `cmd:"" help:"Plot the history of the compensation pool."`
+		Estimate struct {
+			Input  string  `arg:"" name:"input" help:"compensation.csv written by reactions." type:"existingfile"`
+			Banked float64 `help:"Amount of banked buzz to estimate the payout for."`
+		} `cmd:"" help:"Estimate the month end dollars per buzz and payout."`
+	} `cmd:"" help:"Analyze the Creator Program compensation pool."`
+	Creator struct {
+		Audit  string `help:"Audit log of bank and extract actions." default:"creator_audit.csv"`
+		Yes    bool   `help:"Do not ask for confirmation." short:"y"`
+		Status struct {
+		} `cmd:"" help:"Show banked buzz, cap and the bank and extraction windows."`
+		Bank struct {
+			Amount int `arg:"" name:"amount" help:"Amount of buzz to bank."`
+		} `cmd:"" help:"Bank buzz into the compensation pool."`
+		Extract struct {
+		} `cmd:"" help:"Extract this month's banked buzz."`
+	} `cmd:"" help:"Manage Creator Program buzz."`
+	Buzz struct {
+		Balance struct {
+		} `cmd:"" help:"Show the buzz balance."`
+		Transactions struct {
+			Format  string    `help:"Output format." enum:"csv,json" default:"csv"`
+			Since   time.Time `help:"Only export transactions after this date (YYYY-MM-DD)." format:"2006-01-02"`
+			Summary bool      `help:"Print a summary by category instead of the transactions."`
+		} `cmd:"" help:"Export buzz transaction history."`
+	} `cmd:"" help:"Manage buzz."`
+	Schedule struct {
+		Suggest struct {
+			Input      string        `arg:"" name:"input" help:"Input file." type:"existingfile"`
+			Top        int           `help:"Number of slots to list." default:"10"`
+			MinSamples int           `help:"Minimum number of posts in a slot." default:"3"`
+			MinAge     time.Duration `help:"Ignore posts younger than this, their score is still growing." default:"72h"`
+		} `cmd:"" help:"Suggest the best publishing slots for the next week."`
+	} `cmd:"" help:"Plan publishing times."`
 	CSV struct {
-		Input string `arg:"" name:"input" help:"Input file."`
+		Input    string `arg:"" name:"input" help:"Input file."`
+		Template string `help:"Template to render instead of the built in csv.csv. Files ending in .html use html/template, others text/template." type:"existingfile"`
 	} `cmd:"" help:"Generate a CSV."`
+	Export struct {
+		Input    string   `arg:"" name:"input" help:"Input file." type:"existingfile"`
+		Type     string   `help:"What to export." enum:"images,posts" default:"images"`
+		Format   string   `help:"Output format." enum:"csv,tsv,jsonl,parquet" default:"csv"`
+		Columns  []string `help:"Columns to export, defaults to ${default_image_columns} for images and ${default_post_columns} for posts."`
+		From     string   `help:"Only export images published on or after this date (YYYY-MM-DD in --tz)."`
+		To       string   `help:"Only export images published before this date (YYYY-MM-DD in --tz)."`
+		MinScore int      `help:"Only export images, or posts, with at least this score."`
+		Output   string   `help:"File to write to, defaults to stdout." short:"o"`
+	} `cmd:"" help:"Export images or posts as CSV, TSV, JSON lines or Parquet."`
 	Reactions struct {
 		Images string        `help:"path to the file with images." default:"images.txt"`
 		Models string        `help:"path to the file with models." default:"models.txt"`
@@ -81,60 +231,146 @@ func main() {
 }
 
 func run() error {
-	ctx := kong.Parse(&CLI)
+	ctx := kong.Parse(&CLI, kong.Vars{
+		"default_image_columns": defaultImageColumns,
+		"default_post_columns":  defaultPostColumns,
+	})
+	loc, err := time.LoadLocation(CLI.TZ)
+	if err != nil {
+		return err
+	}
+	tz = loc
 	switch ctx.Command() {
 	case "images metadata <username> <id>":
 		c := trpc.New(CLI.APIKey, CLI.Cookies)
 		ctx := context.Background()
-		var items []trpc.Item
-		iter := c.ImagesForUser(ctx, CLI.Images.Metadata.Username, CLI.Images.Metadata.Id)
-		for iter.Next() {
-			items = append(items, iter.Item())
+		images := c.ImagesForUser(ctx, CLI.Images.Metadata.Username, CLI.Images.Metadata.Id).All()
+		if CLI.Images.Metadata.Limit > 0 {
+			images = algorithms.Take(images, CLI.Images.Metadata.Limit)
 		}
-		if err := iter.Err(); err != nil {
+		if CLI.Images.Metadata.Since != "" {
+			previous, err := readItems(CLI.Images.Metadata.Since)
+			if err != nil {
+				return err
+			}
+			items, err := syncImages(images, previous, CLI.Images.Metadata.Refresh)
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(os.Stdout).Encode(items)
+		}
+		items, err := algorithms.Collect(images)
+		if err != nil {
 			return err
 		}
 		return json.NewEncoder(os.Stdout).Encode(items)
 
+	case "images refresh <input>":
+		items, err := readItems(CLI.Images.Refresh.Input)
+		if err != nil {
+			return err
+		}
+		history, err := os.OpenFile(CLI.Images.Refresh.History, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer history.Close()
+		r := &Refresher{
+			trpc:        trpc.New(CLI.APIKey, CLI.Cookies),
+			window:      CLI.Images.Refresh.Window,
+			concurrency: CLI.Images.Refresh.Concurrency,
+			interval:    CLI.Images.Refresh.Interval,
+		}
+		if err := r.Refresh(context.Background(), items, history); err != nil {
+			return err
+		}
+		output := CLI.Images.Refresh.Output
+		if output == "" {
+			output = CLI.Images.Refresh.Input
+		}
+		return writeJSONFile(output, items)
 	case "orchestrator download":
 		c := trpc.New(CLI.APIKey, CLI.Cookies)
 		ctx := context.Background()
-		iter := c.QueryGeneratedImages(ctx)
-		for iter.Next() {
-			item := iter.Item()
-			for _, step := range item.Steps {
-				for _, image := range step.Images {
-					ext := filepath.Ext(image.ID)
-					if ext == "" {
-						ext = ".jpeg"
-					} else {
-						ext = ""
-					}
-					path := filepath.Join(
-						"generated",
-						fmt.Sprintf("%04d", image.Completed.Year()),
-						fmt.Sprintf("%02d", image.Completed.Month()),
-						fmt.Sprintf("%02d", image.Completed.Day()),
-						image.ID+ext,
-					)
-					fmt.Println(image.URL, path)
-					if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-						return err
-					}
-					if err := requests.URL(image.URL).ToFile(path).Fetch(ctx); err != nil {
-						fmt.Println(err) // some images are missing
-					}
-				}
+		for item, err := range c.QueryGeneratedImages(ctx).All() {
+			if err != nil {
+				return err
+			}
+			if err := downloadGeneration(ctx, item); err != nil {
+				return err
 			}
 		}
-		return iter.Err()
+		return nil
+	case "orchestrator generate <recipe>":
+		recipe, err := readRecipe(CLI.Orchestrator.Generate.Recipe)
+		if err != nil {
+			return err
+		}
+		jobs, err := recipe.Jobs()
+		if err != nil {
+			return err
+		}
+		if err := writeJobs(os.Stdout, jobs); err != nil {
+			return err
+		}
+		if CLI.Orchestrator.Generate.DryRun {
+			return nil
+		}
+		if !CLI.Orchestrator.Generate.Yes && !confirm(os.Stdin, os.Stdout, fmt.Sprintf("Submit %d jobs?", len(jobs))) {
+			return nil
+		}
+		g := &Generator{
+			client:   trpc.New(CLI.APIKey, CLI.Cookies),
+			Interval: CLI.Orchestrator.Generate.Interval,
+			Timeout:  CLI.Orchestrator.Generate.Timeout,
+		}
+		return g.Run(context.Background(), os.Stdout, jobs)
+	case "orchestrator list":
+		from, err := parseDate(CLI.Orchestrator.List.From)
+		if err != nil {
+			return err
+		}
+		to, err := parseDate(CLI.Orchestrator.List.To)
+		if err != nil {
+			return err
+		}
+		f := &GenerationFilter{
+			From:     from,
+			To:       to,
+			Statuses: CLI.Orchestrator.List.Status,
+			Model:    CLI.Orchestrator.List.Model,
+		}
+		generations, err := listGenerations(context.Background(), trpc.New(CLI.APIKey, CLI.Cookies), f)
+		if err != nil {
+			return err
+		}
+		if CLI.Orchestrator.List.Format == "json" {
+			return writeGenerationsJSON(os.Stdout, generations)
+		}
+		return writeGenerations(os.Stdout, generations)
+	case "orchestrator triage <input>":
+		items, err := readItems(CLI.Orchestrator.Triage.Input)
+		if err != nil {
+			return err
+		}
+		t := &Triage{
+			Dir:       CLI.Orchestrator.Triage.Downloads,
+			Threshold: CLI.Orchestrator.Triage.Threshold,
+			Window:    CLI.Orchestrator.Triage.Window,
+		}
+		generations, err := t.Match(items)
+		if err != nil {
+			return err
+		}
+		return printTriage(os.Stdout, generations)
 
 	case "users download <username> <id>":
 		c := trpc.New(CLI.APIKey, CLI.Cookies)
 		ctx := context.Background()
-		iter := c.ImagesForUser(ctx, CLI.Images.Metadata.Username, CLI.Images.Metadata.Id)
-		for iter.Next() {
-			img := iter.Item()
+		for img, err := range c.ImagesForUser(ctx, CLI.Images.Metadata.Username, CLI.Images.Metadata.Id).All() {
+			if err != nil {
+				return err
+			}
 			path := filepath.Join(
 				"posts",
 				strconv.Itoa(img.PostID),
@@ -151,14 +387,15 @@ func run() error {
 				fmt.Printf("%+v\n", img)
 			}
 		}
-		return iter.Err()
+		return nil
 	case "posts download <id>":
 		c := trpc.New(CLI.APIKey, CLI.Cookies)
 		ctx := context.Background()
 		for _, id := range CLI.Posts.Download.Ids {
-			iter := c.ImagesForPost(ctx, id)
-			for iter.Next() {
-				img := iter.Item()
+			for img, err := range c.ImagesForPost(ctx, id).All() {
+				if err != nil {
+					return err
+				}
 				path := filepath.Join(
 					"posts",
 					strconv.Itoa(img.PostID),
@@ -177,34 +414,263 @@ func run() error {
 			}
 		}
 		return nil
-	case "report <input>":
-		var items []*trpc.Item
-		f, err := os.Open(CLI.Report.Input)
+	case "report render <input>":
+		items, err := readItems(CLI.Report.Render.Input)
+		if err != nil {
+			return err
+		}
+		items = algorithms.Filter(items, func(img *trpc.Item) bool {
+			return img.Published()
+		})
+		def, err := loadReportDefinition(CLI.Report.Render.Definition)
+		if err != nil {
+			return err
+		}
+		var thumbs *thumbnailer
+		if CLI.Report.Render.Offline {
+			if _, err := offlineScripts(); err != nil {
+				return err
+			}
+			thumbs = newThumbnailer(CLI.Report.Render.Downloads, CLI.Report.Render.Thumbnail)
+		}
+		d := &data{
+			Items:   items,
+			thumbs:  thumbs,
+			offline: CLI.Report.Render.Offline,
+		}
+		if CLI.Report.Render.Meta != "" {
+			if d.meta, err = readImageMeta(CLI.Report.Render.Meta); err != nil {
+				return err
+			}
+		}
+		return d.render(os.Stdout, def, CLI.Report.Render.Template)
+	case "serve <input>":
+		srv := &Server{
+			Input:      CLI.Serve.Input,
+			Definition: CLI.Serve.Definition,
+			Template:   CLI.Serve.Template,
+			Reactions:  CLI.Serve.Reactions,
+		}
+		if CLI.Serve.Downloads != "" {
+			srv.Thumbs = newThumbnailer(CLI.Serve.Downloads, CLI.Serve.Thumbnail)
+		}
+		log.Printf("Serving %s on http://%s", CLI.Serve.Input, CLI.Serve.Addr)
+		return http.ListenAndServe(CLI.Serve.Addr, srv.Handler())
+	case "images significance <input>":
+		items, err := readItems(CLI.Images.Significance.Input)
+		if err != nil {
+			return err
+		}
+		c := &Comparison{
+			Metric: CLI.Images.Significance.Metric,
+			A:      CLI.Images.Significance.A.group(),
+			B:      CLI.Images.Significance.B.group(),
+		}
+		if c.A.Title == "" {
+			c.A.Title = "A"
+		}
+		if c.B.Title == "" {
+			c.B.Title = "B"
+		}
+		d := &data{Items: algorithms.Filter(items, func(img *trpc.Item) bool {
+			return img.Published()
+		})}
+		if len(c.A.Tags) > 0 || len(c.B.Tags) > 0 {
+			if d.meta, err = readImageMeta(CLI.Images.Significance.Meta); err != nil {
+				return err
+			}
+		}
+		printSignificance(os.Stdout, c.Test(d, CLI.Images.Significance.Resamples))
+		return nil
+	case "images anomalies <input>":
+		items, err := readItems(CLI.Images.Anomalies.Input)
+		if err != nil {
+			return err
+		}
+		d := &data{Items: algorithms.Filter(items, func(img *trpc.Item) bool {
+			return img.Published()
+		})}
+		a := &AnomalyDetector{Threshold: CLI.Images.Anomalies.Threshold, MinAge: CLI.Images.Anomalies.MinAge}
+		anomalies, err := a.Detect(d.Posts())
+		if err != nil {
+			return err
+		}
+		if since := CLI.Images.Anomalies.Since; since > 0 {
+			anomalies = Filter(anomalies, func(a *Anomaly) bool {
+				return time.Since(a.PublishedAt) < since
+			})
+		}
+		return printAnomalies(os.Stdout, anomalies)
+	case "posts analyze <input>":
+		items, err := readItems(CLI.Posts.Analyze.Input)
+		if err != nil {
+			return err
+		}
+		d := &data{Items: algorithms.Filter(items, func(img *trpc.Item) bool {
+			return img.Published()
+		})}
+		return printPostAnalysis(os.Stdout, analyzePosts(d.Posts(), CLI.Posts.Analyze.MinAge, CLI.Posts.Analyze.MinPosts))
+	case "report resources <input>":
+		items, err := readItems(CLI.Report.Resources.Input)
+		if err != nil {
+			return err
+		}
+		meta, err := readImageMeta(CLI.Report.Resources.Meta)
+		if err != nil {
+			return err
+		}
+		d := &data{Items: algorithms.Filter(items, func(img *trpc.Item) bool {
+			return img.Published()
+		})}
+		return printResources(os.Stdout, breakdownResources(d.Images(), meta, CLI.Report.Resources.MinImages))
+	case "report prompts <input>":
+		items, err := readItems(CLI.Report.Prompts.Input)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-		if err := json.NewDecoder(f).Decode(&items); err != nil {
+		meta, err := readImageMeta(CLI.Report.Prompts.Meta)
+		if err != nil {
+			return err
+		}
+		d := &data{Items: algorithms.Filter(items, func(img *trpc.Item) bool {
+			return img.Published()
+		})}
+		return writePromptsCSV(os.Stdout, analyzePrompts(d.Images(), meta, CLI.Report.Prompts.MinImages))
+	case "images meta <username>":
+		previous, err := readImageMeta(CLI.Images.Meta.Output)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		f := &MetaFetcher{
+			civit:    civit.New(CLI.APIKey),
+			trpc:     trpc.New(CLI.APIKey, CLI.Cookies),
+			interval: CLI.Images.Meta.Interval,
+			refetch:  CLI.Images.Meta.Refetch,
+		}
+		metas, err := f.Fetch(context.Background(), CLI.Images.Meta.Username, previous)
+		if err != nil {
+			return err
+		}
+		return writeJSONFile(CLI.Images.Meta.Output, metas)
+	case "images dedupe <input>":
+		items, err := readItems(CLI.Images.Dedupe.Input)
+		if err != nil {
+			return err
+		}
+		d := &Deduper{
+			Dir:              CLI.Images.Dedupe.Downloads,
+			Generated:        CLI.Images.Dedupe.Generated,
+			Threshold:        CLI.Images.Dedupe.Threshold,
+			BlurhashDistance: CLI.Images.Dedupe.BlurhashDistance,
+		}
+		clusters, err := d.Clusters(items)
+		if err != nil {
+			return err
+		}
+		return printClusters(os.Stdout, clusters)
+	case "report compare <input>":
+		return compareReport(os.Stdout, CLI.Report.Compare.Inputs, CLI.Report.Compare.Days)
+	case "models report <input>":
+		return modelsReport(os.Stdout, CLI.Models.Report.Inputs)
+	case "compensation history <input>":
+		samples, err := readCompensation(CLI.Compensation.History.Input)
+		if err != nil {
+			return err
+		}
+		return compensationHistory(os.Stdout, samples)
+	case "compensation estimate <input>":
+		samples, err := readCompensation(CLI.Compensation.Estimate.Input)
+		if err != nil {
+			return err
+		}
+		return printEstimate(os.Stdout, samples, CLI.Compensation.Estimate.Banked)
+	case "creator status":
+		return newCreatorProgram().Status(context.Background())
+	case "creator bank <amount>":
+		return newCreatorProgram().Bank(context.Background(), CLI.Creator.Bank.Amount)
+	case "creator extract":
+		return newCreatorProgram().Extract(context.Background())
+	case "buzz balance":
+		c := trpc.New(CLI.APIKey, CLI.Cookies)
+		account, err := c.BuzzGetUserAccount(context.Background())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Balance: %d buzz (lifetime %d)\n", account.Balance, account.LifetimeBalance)
+		return nil
+	case "buzz transactions":
+		c := trpc.New(CLI.APIKey, CLI.Cookies)
+		txs, err := buzzTransactions(context.Background(), c, CLI.Buzz.Transactions.Since)
+		if err != nil {
+			return err
+		}
+		switch {
+		case CLI.Buzz.Transactions.Summary:
+			return writeTransactionsSummary(os.Stdout, txs)
+		case CLI.Buzz.Transactions.Format == "json":
+			return writeTransactionsJSON(os.Stdout, txs)
+		default:
+			return writeTransactionsCSV(os.Stdout, txs)
+		}
+	case "schedule suggest <input>":
+		items, err := readItems(CLI.Schedule.Suggest.Input)
+		if err != nil {
 			return err
 		}
 		items = algorithms.Filter(items, func(img *trpc.Item) bool {
 			return img.Published()
 		})
-		return report(os.Stdout, items)
+		s := &Scheduler{
+			Location:   tz,
+			MinAge:     CLI.Schedule.Suggest.MinAge,
+			MinSamples: CLI.Schedule.Suggest.MinSamples,
+		}
+		return s.Suggest(os.Stdout, (&data{Items: items}).Posts(), CLI.Schedule.Suggest.Top)
 	case "csv <input>":
-		var items []*trpc.Item
-		f, err := os.Open(CLI.CSV.Input)
+		items, err := readItems(CLI.CSV.Input)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-		if err := json.NewDecoder(f).Decode(&items); err != nil {
+		items = algorithms.Filter(items, func(img *trpc.Item) bool {
+			return img.Published()
+		})
+		return csv(os.Stdout, items, CLI.CSV.Template)
+	case "export <input>":
+		items, err := readItems(CLI.Export.Input)
+		if err != nil {
 			return err
 		}
 		items = algorithms.Filter(items, func(img *trpc.Item) bool {
 			return img.Published()
 		})
-		return csv(os.Stdout, items)
+		e := &Exporter{
+			Format:   CLI.Export.Format,
+			Columns:  CLI.Export.Columns,
+			MinScore: CLI.Export.MinScore,
+		}
+		if e.From, err = parseDate(CLI.Export.From); err != nil {
+			return err
+		}
+		if e.To, err = parseDate(CLI.Export.To); err != nil {
+			return err
+		}
+		export := e.ExportImages
+		if CLI.Export.Type == "posts" {
+			export = e.ExportPosts
+		}
+		d := &data{Items: items}
+		if CLI.Export.Output == "" {
+			return export(os.Stdout, d)
+		}
+		f, err := os.Create(CLI.Export.Output)
+		if err != nil {
+			return err
+		}
+		if err := export(f, d); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
 	case "reactions":
 		reactions := &ReactionsProcessor{
 			imagesFile: CLI.Reactions.Images,
@@ -231,15 +697,10 @@ func run() error {
 		}
 		return nil
 	case "showcase leaderboard <input>":
-		var items []*trpc.Item
-		f, err := os.Open(CLI.Showcase.Leaderboard.Input)
+		items, err := readItems(CLI.Showcase.Leaderboard.Input)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-		if err := json.NewDecoder(f).Decode(&items); err != nil {
-			return err
-		}
 		items = algorithms.Filter(items, func(img *trpc.Item) bool {
 			return img.Published()
 		})
@@ -314,12 +775,13 @@ func run() error {
 	case "users following":
 		c := trpc.New(CLI.APIKey, CLI.Cookies)
 		ctx := context.Background()
-		iter := c.UsersFollowing(ctx)
-		for iter.Next() {
-			user := iter.Item()
+		for user, err := range c.UsersFollowing(ctx).All() {
+			if err != nil {
+				return err
+			}
 			fmt.Println(user)
 		}
-		return iter.Err()
+		return nil
 	default:
 		return fmt.Errorf("unknown command: %s", ctx.Command())
 	}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	_ "embed"
+	stdcsv "encoding/csv"
+	"errors"
+	"html/template"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed models.html
+var modelsHTML string
+
+// modelSample is one row of a models csv written by ReactionsProcessor.processModels.
+// Rows written before all Rank fields were recorded only carry Generations.
+type modelSample struct {
+	Time        time.Time
+	Generations int
+	Downloads   int
+	RatingCount int
+	Rating      int
+	ThumbsUp    int
+	ThumbsDown  int
+	// Full is false for legacy rows that only recorded Generations.
+	Full bool
+}
+
+// ThumbsUpRatio returns the fraction of thumbs that are up, or 0 if there are none.
+func (s modelSample) ThumbsUpRatio() float64 {
+	if s.ThumbsUp+s.ThumbsDown == 0 {
+		return 0
+	}
+	return float64(s.ThumbsUp) / float64(s.ThumbsUp+s.ThumbsDown)
+}
+
+type modelVersion struct {
+	Name    string
+	Samples []modelSample
+}
+
+// modelDay is the change in a model version's counters over one calendar day.
+type modelDay struct {
+	Day         time.Time
+	Generations int
+	Downloads   int
+	ThumbsUp    int
+	ThumbsDown  int
+	// ThumbsUpRatio is the all time ratio at the end of the day.
+	ThumbsUpRatio float64
+}
+
+// Latest returns the most recent sample.
+func (v *modelVersion) Latest() modelSample {
+	return v.Samples[len(v.Samples)-1]
+}
+
+// Daily returns the per day deltas in tz, using the last sample of each day.
+func (v *modelVersion) Daily() []modelDay {
+	var last []modelSample
+	for _, s := range v.Samples {
+		day := truncateDay(s.Time.In(tz))
+		if len(last) > 0 && truncateDay(last[len(last)-1].Time.In(tz)).Equal(day) {
+			last[len(last)-1] = s
+			continue
+		}
+		last = append(last, s)
+	}
+	var days []modelDay
+	for i := 1; i < len(last); i++ {
+		prev, cur := last[i-1], last[i]
+		d := modelDay{
+			Day:         truncateDay(cur.Time.In(tz)),
+			Generations: cur.Generations - prev.Generations,
+		}
+		if prev.Full && cur.Full {
+			d.Downloads = cur.Downloads - prev.Downloads
+			d.ThumbsUp = cur.ThumbsUp - prev.ThumbsUp
+			d.ThumbsDown = cur.ThumbsDown - prev.ThumbsDown
+		}
+		if cur.Full {
+			d.ThumbsUpRatio = cur.ThumbsUpRatio()
+		}
+		days = append(days, d)
+	}
+	return days
+}
+
+// GenerationsPerDay returns the average number of generations per day over the trailing window.
+func (v *modelVersion) GenerationsPerDay(window time.Duration) float64 {
+	latest := v.Latest()
+	cutoff := latest.Time.Add(-window)
+	i := slices.IndexFunc(v.Samples, func(s modelSample) bool {
+		return !s.Time.Before(cutoff)
+	})
+	first := v.Samples[i]
+	elapsed := latest.Time.Sub(first.Time)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(latest.Generations-first.Generations) / elapsed.Hours() * 24
+}
+
+// readModelSamples parses a models csv written by ReactionsProcessor.processModels.
+// Samples are appended to the version with the same name in versions.
+func readModelSamples(r io.Reader, versions map[string]*modelVersion) error {
+	cr := stdcsv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) < 3 {
+			continue
+		}
+		ts, err := time.ParseInLocation(time.DateTime, record[0], time.Local)
+		if err != nil {
+			return err
+		}
+		ints := make([]int, len(record)-2)
+		for i, f := range record[2:] {
+			if ints[i], err = strconv.Atoi(f); err != nil {
+				return err
+			}
+		}
+		s := modelSample{Time: ts, Generations: ints[0]}
+		if len(ints) >= 6 {
+			s.Downloads, s.RatingCount, s.Rating = ints[1], ints[2], ints[3]
+			s.ThumbsUp, s.ThumbsDown = ints[4], ints[5]
+			s.Full = true
+		}
+		name := strings.Trim(record[1], `"`)
+		if versions[name] == nil {
+			versions[name] = &modelVersion{Name: name}
+		}
+		versions[name].Samples = append(versions[name].Samples, s)
+	}
+}
+
+type modelsData struct {
+	Versions []*modelVersion
+}
+
+// DailyJSON prepares the per day deltas of every version for plotting.
+func (d *modelsData) DailyJSON() (template.JS, error) {
+	type row struct {
+		Version       string    `json:"version"`
+		Day           time.Time `json:"day"`
+		Generations   int       `json:"generations"`
+		Downloads     int       `json:"downloads"`
+		ThumbsUpRatio float64   `json:"thumbsUpRatio,omitempty"`
+	}
+	var rows []row
+	for _, v := range d.Versions {
+		for _, day := range v.Daily() {
+			rows = append(rows, row{v.Name, day.Day, day.Generations, day.Downloads, day.ThumbsUpRatio})
+		}
+	}
+	return jsonJS(rows)
+}
+
+func modelsReport(w io.Writer, inputs []string) error {
+	versions := make(map[string]*modelVersion)
+	for _, input := range inputs {
+		f, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		err = readModelSamples(f, versions)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	data := &modelsData{}
+	for _, v := range versions {
+		slices.SortStableFunc(v.Samples, func(a, b modelSample) int {
+			return a.Time.Compare(b.Time)
+		})
+		data.Versions = append(data.Versions, v)
+	}
+	slices.SortStableFunc(data.Versions, func(a, b *modelVersion) int {
+		return b.Latest().Generations - a.Latest().Generations
+	})
+
+	funcs := template.FuncMap{
+		"days": func(n int) time.Duration {
+			return time.Duration(n) * 24 * time.Hour
+		},
+		"reverse": func(days []modelDay) []modelDay {
+			slices.Reverse(days)
+			return days
+		},
+		"take": func(n int, days []modelDay) []modelDay {
+			return days[:min(n, len(days))]
+		},
+	}
+	t, err := template.New("models.html").Funcs(funcs).Parse(modelsHTML)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
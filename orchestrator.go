@@ -0,0 +1,150 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/d00918380/civit/internal/trpc"
+)
+
+// GenerationFilter selects generation workflows.
+type GenerationFilter struct {
+	// From and To bound the creation time, the zero time leaves them open.
+	From, To time.Time
+	// Statuses are the workflow statuses to keep, empty for all.
+	Statuses []string
+	// Model is matched case insensitively against the base model and the names of
+	// the resources, or exactly against their model version ids.
+	Model string
+}
+
+// Match reports whether g passes the filter.
+func (f *GenerationFilter) Match(g *trpc.GeneratedItem) bool {
+	if !f.From.IsZero() && g.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !g.CreatedAt.Before(f.To) {
+		return false
+	}
+	if len(f.Statuses) > 0 && !slices.ContainsFunc(f.Statuses, func(s string) bool {
+		return strings.EqualFold(s, g.Status)
+	}) {
+		return false
+	}
+	if f.Model == "" {
+		return true
+	}
+	model := strings.ToLower(f.Model)
+	for _, step := range g.Steps {
+		if strings.Contains(strings.ToLower(step.Params.BaseModel), model) {
+			return true
+		}
+		for _, r := range step.Resources {
+			if strconv.Itoa(r.ID) == f.Model ||
+				strings.Contains(strings.ToLower(r.Name), model) ||
+				strings.Contains(strings.ToLower(r.Model.Name), model) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listGenerations fetches the current user's generation workflows that pass f.
+func listGenerations(ctx context.Context, c *trpc.Client, f *GenerationFilter) ([]*trpc.GeneratedItem, error) {
+	var generations []*trpc.GeneratedItem
+	for g, err := range c.QueryGeneratedImages(ctx).All() {
+		if err != nil {
+			return nil, err
+		}
+		if !f.From.IsZero() && g.CreatedAt.Before(f.From) {
+			break // newest first
+		}
+		if f.Match(&g) {
+			generations = append(generations, &g)
+		}
+	}
+	return generations, nil
+}
+
+// writeGenerations writes a line per workflow with its parameters, status and cost.
+func writeGenerations(w io.Writer, generations []*trpc.GeneratedItem) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "created\tid\tstatus\ttype\tbase model\tresources\tsize\timages\tcost\tprompt\n")
+	var cost float64
+	for _, g := range generations {
+		cost += g.TotalCost
+		var typ, baseModel, size, prompt string
+		var resources []string
+		for _, step := range g.Steps {
+			typ, baseModel, prompt = step.Type, step.Params.BaseModel, step.Params.Prompt
+			size = fmt.Sprintf("%dx%d", step.Params.Width, step.Params.Height)
+			for _, r := range step.Resources {
+				name := cmp.Or(r.Model.Name, r.Name, strconv.Itoa(r.ID))
+				if r.Strength != nil {
+					name += fmt.Sprintf(":%g", *r.Strength)
+				}
+				resources = append(resources, name)
+			}
+		}
+		prompt = strings.Join(strings.Fields(prompt), " ")
+		if r := []rune(prompt); len(r) > 60 {
+			prompt = string(r[:57]) + "..."
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%.0f\t%s\n",
+			g.CreatedAt.In(tz).Format(time.DateTime), g.ID, g.Status, typ, baseModel,
+			strings.Join(resources, ", "), size, len(g.Images()), g.TotalCost, prompt)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d generations, %.0f buzz\n", len(generations), cost)
+	return err
+}
+
+func writeGenerationsJSON(w io.Writer, generations []*trpc.GeneratedItem) error {
+	return json.NewEncoder(w).Encode(generations)
+}
+
+// generationPath is where downloaded generations are saved: generated/YYYY/MM/DD/<id>.
+func generationPath(image trpc.GeneratedImage) string {
+	ext := filepath.Ext(image.ID)
+	if ext == "" {
+		ext = ".jpeg"
+	} else {
+		ext = ""
+	}
+	return filepath.Join(
+		"generated",
+		fmt.Sprintf("%04d", image.Completed.Year()),
+		fmt.Sprintf("%02d", image.Completed.Month()),
+		fmt.Sprintf("%02d", image.Completed.Day()),
+		image.ID+ext,
+	)
+}
+
+// downloadGeneration saves the images of a workflow, printing the url and path of each.
+func downloadGeneration(ctx context.Context, g trpc.GeneratedItem) error {
+	for _, image := range g.Images() {
+		path := generationPath(image)
+		fmt.Println(image.URL, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := requests.URL(image.URL).ToFile(path).Fetch(ctx); err != nil {
+			fmt.Println(err) // some images are missing
+		}
+	}
+	return nil
+}
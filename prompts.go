@@ -0,0 +1,240 @@
+package main
+
+import (
+	"cmp"
+	stdcsv "encoding/csv"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/montanaflynn/stats"
+)
+
+// promptTerm is a comma separated term of a prompt with its attention weight.
+type promptTerm struct {
+	Text   string
+	Weight float64
+}
+
+// networkTag matches extra network tags such as <lora:name:0.8>.
+var networkTag = regexp.MustCompile(`<(\w+):([^:>]+)(?::([^:>]*))?[^>]*>`)
+
+// breakKeyword separates chunks of a prompt like a comma.
+var breakKeyword = regexp.MustCompile(`\bBREAK\b`)
+
+// explicitWeight matches the weight at the end of a (text:1.2) group.
+var explicitWeight = regexp.MustCompile(`^:\s*([+-]?[.\d]+)\s*\)`)
+
+// parsePrompt splits a prompt into terms, following the A1111 attention syntax:
+// (text) multiplies the weight of text by 1.1, [text] divides it by 1.1, (text:w)
+// sets it to w, \( escapes a bracket and BREAK separates terms. Extra network
+// tags like <lora:name:0.8> become a term "<lora:name>" with their strength as weight.
+func parsePrompt(prompt string) []promptTerm {
+	var terms []promptTerm
+	prompt = networkTag.ReplaceAllStringFunc(prompt, func(tag string) string {
+		m := networkTag.FindStringSubmatch(tag)
+		w, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			w = 1
+		}
+		terms = append(terms, promptTerm{Text: "<" + strings.ToLower(m[1]) + ":" + strings.TrimSpace(m[2]) + ">", Weight: w})
+		return ","
+	})
+	prompt = breakKeyword.ReplaceAllString(prompt, ",")
+
+	// pieces of text with their weight, brackets split the prompt into pieces
+	type piece struct {
+		text   string
+		weight float64
+	}
+	var pieces []piece
+	var round, square []int
+	multiply := func(from int, by float64) {
+		for i := from; i < len(pieces); i++ {
+			pieces[i].weight *= by
+		}
+	}
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			pieces = append(pieces, piece{text.String(), 1})
+			text.Reset()
+		}
+	}
+	for i := 0; i < len(prompt); i++ {
+		switch c := prompt[i]; {
+		case c == '\\' && i+1 < len(prompt):
+			i++
+			text.WriteByte(prompt[i])
+		case c == '(':
+			flush()
+			round = append(round, len(pieces))
+		case c == '[':
+			flush()
+			square = append(square, len(pieces))
+		case c == ':' && len(round) > 0 && explicitWeight.MatchString(prompt[i:]):
+			flush()
+			m := explicitWeight.FindStringSubmatch(prompt[i:])
+			w, _ := strconv.ParseFloat(m[1], 64)
+			multiply(round[len(round)-1], w)
+			round = round[:len(round)-1]
+			i += len(m[0]) - 1
+		case c == ')' && len(round) > 0:
+			flush()
+			multiply(round[len(round)-1], 1.1)
+			round = round[:len(round)-1]
+		case c == ']' && len(square) > 0:
+			flush()
+			multiply(square[len(square)-1], 1/1.1)
+			square = square[:len(square)-1]
+		default:
+			text.WriteByte(c)
+		}
+	}
+	flush()
+	// unclosed brackets still apply, as in A1111
+	for _, from := range round {
+		multiply(from, 1.1)
+	}
+	for _, from := range square {
+		multiply(from, 1/1.1)
+	}
+
+	for _, p := range pieces {
+		for _, t := range strings.FieldsFunc(p.text, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if t = normalizeTerm(t); t != "" {
+				terms = append(terms, promptTerm{Text: t, Weight: math.Round(p.weight*1000) / 1000})
+			}
+		}
+	}
+	return terms
+}
+
+func normalizeTerm(t string) string {
+	return strings.Join(strings.Fields(strings.ToLower(t)), " ")
+}
+
+// PromptTermStats is how images using a prompt term perform.
+type PromptTermStats struct {
+	Term string
+	// Negative is true for terms of the negative prompt.
+	Negative bool
+	Images   int
+	// MeanWeight is the mean attention weight of the term.
+	MeanWeight float64
+	// Mean and MeanWithout are the mean scores of images with and without the term.
+	Mean, MeanWithout float64
+	// Correlation is the correlation of using the term with log(1+score), over every
+	// image with a prompt.
+	Correlation float64
+	// WeightCorrelation is the correlation of the weight with log(1+score), over the
+	// images using the term. NaN if the weight doesn't vary.
+	WeightCorrelation float64
+}
+
+// Lift is the mean score with the term divided by the mean score without it.
+func (s PromptTermStats) Lift() float64 {
+	if s.MeanWithout == 0 {
+		return 0
+	}
+	return s.Mean / s.MeanWithout
+}
+
+// analyzePrompts correlates the terms of the prompts of images with their score.
+// Terms used by fewer than minImages images are left out, the rest are ranked by
+// Correlation, highest first.
+func analyzePrompts(images []*image, meta map[int]*imageMeta, minImages int) []PromptTermStats {
+	type use struct {
+		image  int
+		weight float64
+	}
+	type key struct {
+		term     string
+		negative bool
+	}
+	uses := make(map[key][]use)
+	var scores []float64
+	for _, i := range images {
+		m := meta[i.ID]
+		if m == nil || m.Meta == nil || m.Meta.Prompt == "" {
+			continue
+		}
+		n := len(scores)
+		scores = append(scores, math.Log1p(float64(i.Score())))
+		for _, p := range []struct {
+			prompt   string
+			negative bool
+		}{{m.Meta.Prompt, false}, {m.Meta.NegativePrompt, true}} {
+			seen := make(map[string]bool)
+			for _, t := range parsePrompt(p.prompt) {
+				// count a term once per image, with its first weight
+				if seen[t.Text] {
+					continue
+				}
+				seen[t.Text] = true
+				k := key{t.Text, p.negative}
+				uses[k] = append(uses[k], use{n, t.Weight})
+			}
+		}
+	}
+
+	var terms []PromptTermStats
+	for k, us := range uses {
+		if len(us) < max(minImages, 1) {
+			continue
+		}
+		present := make([]float64, len(scores))
+		var weights, used []float64
+		for _, u := range us {
+			present[u.image] = 1
+			weights = append(weights, u.weight)
+			used = append(used, scores[u.image])
+		}
+		s := PromptTermStats{Term: k.term, Negative: k.negative, Images: len(us)}
+		s.MeanWeight, _ = stats.Mean(weights)
+		var with, without, nWithout float64
+		for n, score := range scores {
+			if present[n] == 1 {
+				with += math.Expm1(score)
+			} else {
+				without += math.Expm1(score)
+				nWithout++
+			}
+		}
+		s.Mean = with / float64(len(us))
+		if nWithout > 0 {
+			s.MeanWithout = without / nWithout
+		}
+		s.Correlation, _ = stats.Correlation(present, scores)
+		s.WeightCorrelation = math.NaN()
+		if slices.Min(weights) != slices.Max(weights) {
+			s.WeightCorrelation, _ = stats.Correlation(weights, used)
+		}
+		terms = append(terms, s)
+	}
+	slices.SortFunc(terms, func(a, b PromptTermStats) int {
+		return cmp.Or(cmp.Compare(b.Correlation, a.Correlation), cmp.Compare(a.Term, b.Term))
+	})
+	return terms
+}
+
+// writePromptsCSV writes prompt term statistics as CSV.
+func writePromptsCSV(w io.Writer, terms []PromptTermStats) error {
+	cw := stdcsv.NewWriter(w)
+	cw.Write([]string{"term", "negative", "images", "meanWeight", "mean", "meanWithout", "lift", "correlation", "weightCorrelation"})
+	f := func(v float64) string {
+		if math.IsNaN(v) {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', 4, 64)
+	}
+	for _, t := range terms {
+		cw.Write([]string{t.Term, strconv.FormatBool(t.Negative), strconv.Itoa(t.Images), f(t.MeanWeight),
+			f(t.Mean), f(t.MeanWithout), f(t.Lift()), f(t.Correlation), f(t.WeightCorrelation)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePrompt(t *testing.T) {
+	for _, tt := range []struct {
+		prompt string
+		want   []promptTerm
+	}{
+		{"a cat, dog", []promptTerm{{"a cat", 1}, {"dog", 1}}},
+		{"  Two   Words ,UPPER\nnext line", []promptTerm{{"two words", 1}, {"upper", 1}, {"next line", 1}}},
+		{"(red hat), blue", []promptTerm{{"red hat", 1.1}, {"blue", 1}}},
+		{"((red hat))", []promptTerm{{"red hat", 1.21}}},
+		{"[blurry]", []promptTerm{{"blurry", 0.909}}},
+		{"[(balanced)]", []promptTerm{{"balanced", 1}}},
+		{"(red hat:1.5)", []promptTerm{{"red hat", 1.5}}},
+		{"(a:0.5) [b] (c)", []promptTerm{{"a", 0.5}, {"b", 0.909}, {"c", 1.1}}},
+		{"((red:1.2), hat)", []promptTerm{{"red", 1.32}, {"hat", 1.1}}},
+		{`\(escaped\), \[too\]`, []promptTerm{{"(escaped)", 1}, {"[too]", 1}}},
+		{"(unclosed, text", []promptTerm{{"unclosed", 1.1}, {"text", 1.1}}},
+		{"[unclosed", []promptTerm{{"unclosed", 0.909}}},
+		{"stray) brackets]", []promptTerm{{"stray) brackets]", 1}}},
+		{"time: noon", []promptTerm{{"time: noon", 1}}},
+		{"sky BREAK sea", []promptTerm{{"sky", 1}, {"sea", 1}}},
+		{"breakfast, BREAKFAST", []promptTerm{{"breakfast", 1}, {"breakfast", 1}}},
+		{"<lora:DetailTweaker:0.8> portrait", []promptTerm{{"<lora:DetailTweaker>", 0.8}, {"portrait", 1}}},
+		{"<LyCORIS:style:1.2:0.5>, <hypernet:foo>", []promptTerm{{"<lycoris:style>", 1.2}, {"<hypernet:foo>", 1}}},
+		{"(masterpiece <lora:x:0.6>:1.2)", []promptTerm{{"<lora:x>", 0.6}, {"masterpiece", 1.2}}},
+		{"", nil},
+	} {
+		if got := parsePrompt(tt.prompt); !slices.Equal(got, tt.want) {
+			t.Errorf("parsePrompt(%q) = %v, want %v", tt.prompt, got, tt.want)
+		}
+	}
+}
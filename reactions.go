@@ -113,8 +113,11 @@ func (rp *ReactionsProcessor) processModels(input string) error {
 		}
 		log.Printf("Fetched model %d: %v", id, model.Name)
 		for _, version := range model.ModelVersions {
-			log.Printf("%s %s: %d", model.Name, version.Name, version.Rank.GenerationCountAllTime)
-			fmt.Fprintf(out, "%s,%q,%d\n", ts, model.Name+" "+version.Name, version.Rank.GenerationCountAllTime)
+			r := version.Rank
+			log.Printf("%s %s: %d", model.Name, version.Name, r.GenerationCountAllTime)
+			fmt.Fprintf(out, "%s,%q,%d,%d,%d,%d,%d,%d\n", ts, model.Name+" "+version.Name,
+				r.GenerationCountAllTime, r.DownloadCountAllTime, r.RatingCountAllTime, r.RatingAllTime,
+				r.ThumbsUpCountAllTime, r.ThumbsDownCountAllTime)
 		}
 	}
 	return sc.Err()
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/d00918380/civit/internal/trpc"
+)
+
+// Refresher re-queries the stats of already known images.
+type Refresher struct {
+	trpc        *trpc.Client
+	window      time.Duration
+	concurrency int
+	interval    time.Duration
+}
+
+// Refresh updates the stats of every image in items published within the window,
+// in place, and appends a row per refreshed image to history.
+// Requests are spread over the configured number of workers but never issued more
+// often than once per interval. Images that fail to fetch keep their previous stats.
+func (r *Refresher) Refresh(ctx context.Context, items []*trpc.Item, history io.Writer) error {
+	cutoff := time.Now().Add(-r.window)
+	ts := time.Now().Format(time.DateTime)
+
+	limiter := time.NewTicker(max(r.interval, time.Millisecond))
+	defer limiter.Stop()
+
+	work := make(chan *trpc.Item)
+	var mu sync.Mutex // guards history and refreshed
+	var refreshed int
+	var wg sync.WaitGroup
+	for range max(r.concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				select {
+				case <-limiter.C:
+				case <-ctx.Done():
+					return
+				}
+				fresh, err := r.trpc.Image(ctx, item.ID)
+				if err != nil {
+					log.Printf("Error fetching image %d: %v", item.ID, err)
+					continue
+				}
+				item.Stats = fresh.Stats
+				s := item.Stats
+				mu.Lock()
+				refreshed++
+				fmt.Fprintf(history, "%s,%d,%d,%d,%d,%d,%d,%d,%d\n", ts, item.ID,
+					s.LikeCountAllTime, s.LaughCountAllTime, s.HeartCountAllTime, s.CryCountAllTime,
+					s.CommentCountAllTime, s.CollectedCountAllTime, s.TippedAmountCountAllTime)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var queued int
+queue:
+	for _, item := range items {
+		if !item.Published() || item.PublishedAt.Before(cutoff) {
+			continue
+		}
+		select {
+		case work <- item:
+			queued++
+		case <-ctx.Done():
+			break queue
+		}
+	}
+	close(work)
+	wg.Wait()
+	log.Printf("refreshed %d of %d images", refreshed, queued)
+	return ctx.Err()
+}
+
+// writeJSONFile atomically replaces path with v encoded as JSON, keeping the mode of
+// the file it replaces, 0644 for a new file.
+func writeJSONFile(path string, v any) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(v); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"bytes"
+	"cmp"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"maps"
 	"math"
+	"net/url"
 	"slices"
 	"sort"
 	"strings"
@@ -21,31 +25,78 @@ import (
 //go:embed report.html
 var reportHTML string
 
+// tz is the location in which reports bucket days and hours, set by --tz.
+var tz = time.Local
+
 type TimeRange struct {
 	Start time.Time
 	End   time.Time
 }
 
-func report(w io.Writer, items []*trpc.Item) error {
-	data := &data{
-		Items: items,
+// render executes the report template with the sections of def, the embedded
+// report.html unless tmpl is set.
+func (d *data) render(w io.Writer, def *ReportDefinition, tmpl string) error {
+	d.Sections = def.Sections
+	for _, s := range def.Sections {
+		s.data = d
+		s.sections = def.Sections
 	}
+	return executeTemplate(w, "report.html", reportHTML, tmpl, templateFuncs(d), d)
+}
 
-	funcs := template.FuncMap{
+// templateFuncs returns the functions available to report and csv templates.
+// They are documented in README.md and user templates depend on them, so
+// don't rename or change the signature of existing functions.
+func templateFuncs(data *data) map[string]any {
+	return map[string]any{
 		"epoch": func() time.Time {
 			// two years ago
 			return time.Now().Add(-time.Hour * 24 * 365 * 2)
 		},
-		"mean":       stats.Mean,
-		"sum":        stats.Sum,
-		"percentile": stats.Percentile,
-		"stddev":     stats.StandardDeviation,
-		"json": func(v any) (template.JS, error) {
-			var buf bytes.Buffer
-			err := json.NewEncoder(&buf).Encode(v)
-			s := strings.TrimSpace(buf.String()) // stupid json.NewEncoder adds a newline
-			return template.JS(s), err
+		"tz": func() *time.Location {
+			return tz
+		},
+		"serving": func() bool {
+			return data.query != nil
+		},
+		// score_formulas returns the names of the formulas serve can score images with.
+		"score_formulas": func() []string {
+			return slices.Sorted(maps.Keys(scoreFormulas))
+		},
+		"offline": func() bool {
+			return data.offline
+		},
+		// offline_scripts returns the vendored d3 and Plot.
+		"offline_scripts": offlineScripts,
+		// thumbnail returns a data URL of a downloaded image or leaderboard entry, or ""
+		// if thumbnails are disabled or the image hasn't been downloaded.
+		"thumbnail": func(v any) template.URL {
+			if data.thumbs == nil {
+				return ""
+			}
+			switch v := v.(type) {
+			case *image:
+				return data.thumbs.Thumbnail(v)
+			case *LeaderboardEntry:
+				return data.thumbs.Thumbnail(v.image)
+			default:
+				return ""
+			}
+		},
+		"percent": percent,
+		"mean": func(d stats.Float64Data) (float64, error) {
+			return orZero(stats.Mean(d))
 		},
+		"sum": func(d stats.Float64Data) (float64, error) {
+			return orZero(stats.Sum(d))
+		},
+		"percentile": func(d stats.Float64Data, p float64) (float64, error) {
+			return orZero(stats.Percentile(d, p))
+		},
+		"stddev": func(d stats.Float64Data) (float64, error) {
+			return orZero(stats.StandardDeviation(d))
+		},
+		"json": jsonJS,
 		"ago": func(s string) (time.Time, error) {
 			d, err := time.ParseDuration(s)
 			if err != nil {
@@ -59,7 +110,7 @@ func report(w io.Writer, items []*trpc.Item) error {
 		"best_posts_per_day": func(n int) map[time.Time][]*post {
 			days := make(map[time.Time][]*post)
 			for _, p := range data.Posts() {
-				day := p.PublishedAt().Truncate(time.Hour * 24)
+				day := truncateDay(p.PublishedAt().In(tz))
 				days[day] = append(days[day], p)
 			}
 			for day := range days {
@@ -73,7 +124,7 @@ func report(w io.Writer, items []*trpc.Item) error {
 		"worst_posts_per_day": func(n int) map[time.Time][]*post {
 			days := make(map[time.Time][]*post)
 			for _, p := range data.Posts() {
-				day := p.PublishedAt().Truncate(time.Hour * 24)
+				day := truncateDay(p.PublishedAt().In(tz))
 				days[day] = append(days[day], p)
 			}
 			for day := range days {
@@ -88,7 +139,7 @@ func report(w io.Writer, items []*trpc.Item) error {
 		"per_day": func(images []*image) map[time.Time][]*image {
 			days := make(map[time.Time][]*image)
 			for _, i := range images {
-				day := i.PublishedAt.Truncate(time.Hour * 24)
+				day := truncateDay(i.PublishedAt.In(tz))
 				days[day] = append(days[day], i)
 			}
 			return days
@@ -103,9 +154,9 @@ func report(w io.Writer, items []*trpc.Item) error {
 				return insideRange(p.PublishedAt())
 			})
 			slices.SortStableFunc(posts, func(a, b *post) int {
-				return int((a.Efficiency() - b.Efficiency()) * 100)
+				return cmp.Compare(a.Efficiency(), b.Efficiency())
 			})
-			return posts[:n]
+			return posts[:min(n, len(posts))]
 		},
 		"by_score": func(images []*image) []*image {
 			slices.SortStableFunc(images, func(a, b *image) int {
@@ -135,6 +186,9 @@ func report(w io.Writer, items []*trpc.Item) error {
 		"take": func(n int, images []*image) []*image {
 			return images[:min(n, len(images))]
 		},
+		"take_posts": func(n int, posts []*post) []*post {
+			return posts[:min(n, len(posts))]
+		},
 		// less_than returns images with a score less than n
 		"less_than": func(n int, images []*image) []*image {
 			return Filter(images, func(i *image) bool {
@@ -152,6 +206,19 @@ func report(w io.Writer, items []*trpc.Item) error {
 				return float64(i.Score())
 			})
 		},
+		"collected": func(images []*image) stats.Float64Data {
+			return Map(images, func(i *image) float64 {
+				return float64(i.Collected())
+			})
+		},
+		"tipped": func(images []*image) stats.Float64Data {
+			return Map(images, func(i *image) float64 {
+				return float64(i.Tipped())
+			})
+		},
+		"correlation": func(a, b stats.Float64Data) (float64, error) {
+			return orZero(stats.Correlation(a, b))
+		},
 		"by_post": func(images []*image) []*post {
 			posts := make(map[int][]*image)
 			for _, i := range images {
@@ -172,28 +239,35 @@ func report(w io.Writer, items []*trpc.Item) error {
 		"count_by_hour": func(images []*image) [][]*image {
 			hours := make([][]*image, 24)
 			for _, i := range images {
-				hours[i.PublishedAt.Hour()] = append(hours[i.PublishedAt.Hour()], i)
+				hours[i.Hour()] = append(hours[i.Hour()], i)
 			}
 			return hours
 		},
 	}
+}
 
-	t, err := template.New("report.html").Funcs(funcs).Parse(reportHTML)
-	if err != nil {
-		return err
-	}
+type data struct {
+	Items    []*trpc.Item
+	Sections []*Section
 
-	return t.Execute(w, data)
+	// thumbs inlines thumbnails of downloaded images, nil to leave them out.
+	thumbs *thumbnailer
+	// offline leaves out external scripts.
+	offline bool
+	// meta is the generation metadata of images by id, nil if not loaded.
+	meta map[int]*imageMeta
+	// formula scores images, nil for the sum of reactions.
+	formula scoreFormula
+	// query is the query string of a report rendered by serve, nil otherwise.
+	query url.Values
 }
 
-type data struct {
-	Items []*trpc.Item
+func (d *data) image(i *trpc.Item) *image {
+	return &image{Item: i, formula: d.formula}
 }
 
 func (d *data) Images() []*image {
-	return Map(d.Items, func(i *trpc.Item) *image {
-		return &image{i}
-	})
+	return Map(d.Items, d.image)
 }
 
 func (d *data) Posts() []*post {
@@ -202,7 +276,7 @@ func (d *data) Posts() []*post {
 		if _, ok := posts[i.PostID]; !ok {
 			posts[i.PostID] = &post{}
 		}
-		posts[i.PostID].images = append(posts[i.PostID].images, &image{i})
+		posts[i.PostID].images = append(posts[i.PostID].images, d.image(i))
 	}
 	var ps []*post
 	for _, p := range posts {
@@ -217,7 +291,7 @@ func (d *data) Posts() []*post {
 func (d *data) PostsByEfficiency() []*post {
 	posts := d.Posts()
 	slices.SortStableFunc(posts, func(a, b *post) int {
-		return int((b.Efficiency() - a.Efficiency()) * 100)
+		return cmp.Compare(b.Efficiency(), a.Efficiency())
 	})
 	return posts
 }
@@ -230,6 +304,22 @@ func (d *data) PostsByScore() []*post {
 	return posts
 }
 
+func (d *data) PostsByTippedPerImage() []*post {
+	posts := d.Posts()
+	slices.SortStableFunc(posts, func(a, b *post) int {
+		return cmp.Compare(b.TippedPerImage(), a.TippedPerImage())
+	})
+	return posts
+}
+
+func (d *data) PostsByCollectRatio() []*post {
+	posts := d.Posts()
+	slices.SortStableFunc(posts, func(a, b *post) int {
+		return cmp.Compare(b.CollectRatio(), a.CollectRatio())
+	})
+	return posts
+}
+
 func (d *data) PostsByDate() []*post {
 	posts := d.Posts()
 	slices.SortStableFunc(posts, func(a, b *post) int {
@@ -250,6 +340,11 @@ func (d *data) ImagesJSON() any {
 	})
 }
 
+// Query returns the query string of a report rendered by serve.
+func (d *data) Query() url.Values {
+	return d.query
+}
+
 func (d *data) User() string {
 	return First(d.Items).User.Username
 }
@@ -286,8 +381,9 @@ func (d *data) ImagesJS() template.JS {
 	return template.JS(buf.String())
 }
 
+// PostsJSON returns the posts for the JSON API, newest first.
 func (d *data) PostsJSON() any {
-	return Map(d.Posts(), func(p *post) any {
+	return Map(d.PostsByDate(), func(p *post) any {
 		return map[string]any{
 			"id":        p.Id(),
 			"postURL":   p.PostURL(),
@@ -329,19 +425,47 @@ func (d *data) Leaderboard() *Leaderboard {
 
 type image struct {
 	*trpc.Item
+	formula scoreFormula
 }
 
 func (i *image) Score() int {
-	return Sum(i.Stats.LikeCountAllTime, i.Stats.LaughCountAllTime, i.Stats.HeartCountAllTime, i.Stats.CryCountAllTime)
+	if i.formula != nil {
+		return i.formula(i.Item)
+	}
+	return score(i.Item)
+}
+
+// scoreFormula computes the score of an image from its stats.
+type scoreFormula func(*trpc.Item) int
+
+// scoreFormulas are the formulas serve can score images with, by name.
+var scoreFormulas = map[string]scoreFormula{
+	"reactions": score,
+	"likes": func(i *trpc.Item) int {
+		return Sum(i.Stats.LikeCountAllTime, i.Stats.HeartCountAllTime)
+	},
+	"engagement": func(i *trpc.Item) int {
+		return score(i) + Sum(i.Stats.CommentCountAllTime, i.Stats.CollectedCountAllTime)
+	},
+}
+
+// Collected returns the number of times the image was added to a collection.
+func (i *image) Collected() int {
+	return i.Stats.CollectedCountAllTime
+}
+
+// Tipped returns the amount of buzz tipped on the image.
+func (i *image) Tipped() int {
+	return i.Stats.TippedAmountCountAllTime
 }
 
 // time returns the time hh:mm the image was published.
 func (i *image) DateTime() string {
-	return i.PublishedAt.Format(time.DateTime)
+	return i.PublishedAt.In(tz).Format(time.DateTime)
 }
 
 func (i *image) Hour() int {
-	return i.PublishedAt.Hour()
+	return i.PublishedAt.In(tz).Hour()
 }
 
 func (i *image) ImageURL() template.HTMLAttr {
@@ -382,6 +506,31 @@ func (p *post) Efficiency() float64 {
 	return float64(p.Score()) / float64(len(p.Images()))
 }
 
+func (p *post) Collected() int {
+	return Sum(Map(p.images, func(i *image) int {
+		return i.Collected()
+	})...)
+}
+
+func (p *post) Tipped() int {
+	return Sum(Map(p.images, func(i *image) int {
+		return i.Tipped()
+	})...)
+}
+
+// TippedPerImage returns the buzz tipped on the post divided by its number of images.
+func (p *post) TippedPerImage() float64 {
+	return float64(p.Tipped()) / float64(len(p.Images()))
+}
+
+// CollectRatio returns the number of collects per reaction.
+func (p *post) CollectRatio() float64 {
+	if p.Score() == 0 {
+		return 0
+	}
+	return float64(p.Collected()) / float64(p.Score())
+}
+
 type Leaderboard struct {
 	Entries []*LeaderboardEntry
 }
@@ -419,6 +568,12 @@ func Filter[T any](s []T, f func(T) bool) []T {
 	return r
 }
 
+// truncateDay returns midnight of the day t falls on, in t's location.
+// Unlike t.Truncate(24 * time.Hour) this respects the location and DST transitions.
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
 func First[T any](s []T) T {
 	return s[0]
 }
@@ -430,3 +585,20 @@ func Sum[T int | float64](s ...T) T {
 	}
 	return v
 }
+
+// orZero returns 0 instead of an error for empty data, so that a window left
+// without images by a filter renders as zeros rather than failing the report.
+func orZero(v float64, err error) (float64, error) {
+	if errors.Is(err, stats.ErrEmptyInput) {
+		return 0, nil
+	}
+	return v, err
+}
+
+// jsonJS encodes v as JSON for scripts, the json template func.
+func jsonJS(v any) (template.JS, error) {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(v)
+	s := strings.TrimSpace(buf.String()) // stupid json.NewEncoder adds a newline
+	return template.JS(s), err
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/montanaflynn/stats"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed report.yaml
+var reportYAML []byte
+
+// ReportDefinition lists the sections of a report in the order they are rendered.
+// Definitions are written in YAML or JSON, see report.yaml for the default.
+type ReportDefinition struct {
+	Sections []*Section `yaml:"sections"`
+}
+
+// Window is a time range relative to now.
+type Window struct {
+	// From is how long ago the window starts, zero for the beginning of time.
+	From time.Duration `yaml:"from"`
+	// To is how long ago the window ends, zero for now.
+	To time.Duration `yaml:"to"`
+}
+
+func (w Window) Start() time.Time {
+	if w.From == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-w.From)
+}
+
+func (w Window) End() time.Time {
+	return time.Now().Add(-w.To)
+}
+
+func (w Window) Contains(t time.Time) bool {
+	return t.After(w.Start()) && t.Before(w.End())
+}
+
+// NamedWindow is a row of a stats section.
+type NamedWindow struct {
+	Title  string `yaml:"title"`
+	Window `yaml:",inline"`
+}
+
+// Section is one part of a report. Which fields apply depends on Type.
+type Section struct {
+	// Type is one of stats, hours, contents, recent, images, posts, images_per_day,
+	// posts_per_day, leaderboard, monetization, significance, anomalies, post_analysis,
+	// resources or prompts.
+	Type  string `yaml:"type"`
+	ID    string `yaml:"id"`
+	Title string `yaml:"title"`
+	// Window restricts the images or posts of the section, it defaults to all time.
+	Window `yaml:",inline"`
+	// Windows are the rows of a stats section.
+	Windows []NamedWindow `yaml:"windows"`
+	// Sort is the key to order by: score, date, collected or tipped for images,
+	// score, date, efficiency, tipped_per_image or collect_ratio for posts.
+	Sort string `yaml:"sort"`
+	// Ascending sorts smallest first, the default is largest first.
+	Ascending bool `yaml:"ascending"`
+	// Top limits the number of entries, per day for the per day sections. Zero means all.
+	Top int `yaml:"top"`
+	// MinScore and MaxScore filter images by score, inclusive.
+	MinScore *int `yaml:"min_score"`
+	MaxScore *int `yaml:"max_score"`
+	// Comparisons are the tests of a significance section.
+	Comparisons []Comparison `yaml:"comparisons"`
+	// Threshold is the robust z-score beyond which an anomalies section lists an
+	// image, it defaults to 3.
+	Threshold float64 `yaml:"threshold"`
+	// MinAge excludes younger images from an anomalies section, it defaults to 24h,
+	// and younger posts from a post_analysis section, it defaults to 72h.
+	MinAge time.Duration `yaml:"min_age"`
+	// MinPosts is the number of posts a size needs in a post_analysis section to be
+	// the best size, it defaults to 3.
+	MinPosts int `yaml:"min_posts"`
+	// MinImages leaves base models, resources and tags used by fewer images out of a
+	// resources section, it defaults to 3, and prompt terms out of a prompts section,
+	// it defaults to 5.
+	MinImages int `yaml:"min_images"`
+
+	data     *data
+	sections []*Section
+}
+
+var imageSorts = map[string]func(a, b *image) int{
+	"score":     func(a, b *image) int { return cmp.Compare(a.Score(), b.Score()) },
+	"date":      func(a, b *image) int { return a.PublishedAt.Compare(b.PublishedAt) },
+	"collected": func(a, b *image) int { return cmp.Compare(a.Collected(), b.Collected()) },
+	"tipped":    func(a, b *image) int { return cmp.Compare(a.Tipped(), b.Tipped()) },
+}
+
+var postSorts = map[string]func(a, b *post) int{
+	"score":            func(a, b *post) int { return cmp.Compare(a.Score(), b.Score()) },
+	"date":             func(a, b *post) int { return a.PublishedAt().Compare(b.PublishedAt()) },
+	"efficiency":       func(a, b *post) int { return cmp.Compare(a.Efficiency(), b.Efficiency()) },
+	"tipped_per_image": func(a, b *post) int { return cmp.Compare(a.TippedPerImage(), b.TippedPerImage()) },
+	"collect_ratio":    func(a, b *post) int { return cmp.Compare(a.CollectRatio(), b.CollectRatio()) },
+}
+
+// validate checks that the section can be rendered.
+func (s *Section) validate() error {
+	switch s.Type {
+	case "stats", "hours", "contents", "leaderboard", "monetization", "anomalies", "post_analysis", "resources", "prompts":
+	case "significance":
+		for _, c := range s.Comparisons {
+			if err := c.validate(); err != nil {
+				return fmt.Errorf("section %q: %w", s.ID, err)
+			}
+		}
+	case "images", "images_per_day":
+		if _, ok := imageSorts[s.sort()]; !ok {
+			return fmt.Errorf("section %q: unknown image sort %q", s.ID, s.Sort)
+		}
+	case "recent", "posts", "posts_per_day":
+		if _, ok := postSorts[s.sort()]; !ok {
+			return fmt.Errorf("section %q: unknown post sort %q", s.ID, s.Sort)
+		}
+	default:
+		return fmt.Errorf("section %q: unknown type %q", s.ID, s.Type)
+	}
+	return nil
+}
+
+func (s *Section) sort() string {
+	if s.Sort == "" {
+		return "score"
+	}
+	return s.Sort
+}
+
+// images returns the images inside the window and score bounds.
+func (s *Section) images() []*image {
+	return Filter(s.data.Images(), func(i *image) bool {
+		if s.MinScore != nil && i.Score() < *s.MinScore {
+			return false
+		}
+		if s.MaxScore != nil && i.Score() > *s.MaxScore {
+			return false
+		}
+		return s.Contains(i.PublishedAt)
+	})
+}
+
+func (s *Section) sortImages(images []*image) []*image {
+	less := imageSorts[s.sort()]
+	slices.SortStableFunc(images, func(a, b *image) int {
+		if s.Ascending {
+			return less(a, b)
+		}
+		return less(b, a)
+	})
+	return images[:s.limit(len(images))]
+}
+
+func (s *Section) sortPosts(posts []*post) []*post {
+	less := postSorts[s.sort()]
+	slices.SortStableFunc(posts, func(a, b *post) int {
+		if s.Ascending {
+			return less(a, b)
+		}
+		return less(b, a)
+	})
+	return posts[:s.limit(len(posts))]
+}
+
+// limit returns how many of n entries to keep.
+func (s *Section) limit(n int) int {
+	if s.Top > 0 {
+		return min(n, s.Top)
+	}
+	return n
+}
+
+// Images returns the images of an images section.
+func (s *Section) Images() []*image {
+	return s.sortImages(s.images())
+}
+
+// ImagesInWindow returns the images inside the window and score bounds, unsorted and unlimited.
+func (s *Section) ImagesInWindow() []*image {
+	return s.images()
+}
+
+// Posts returns the posts of a posts or recent section.
+func (s *Section) Posts() []*post {
+	return s.sortPosts(s.posts())
+}
+
+// PostsBy returns the posts of the section sorted by key instead of Sort.
+func (s *Section) PostsBy(key string) []*post {
+	c := *s
+	c.Sort = key
+	return c.Posts()
+}
+
+// posts groups the images inside the window and score bounds by post, so a post
+// only contains the images that were published inside the window.
+func (s *Section) posts() []*post {
+	posts := make(map[int]*post)
+	for _, i := range s.images() {
+		if posts[i.PostID] == nil {
+			posts[i.PostID] = &post{}
+		}
+		posts[i.PostID].images = append(posts[i.PostID].images, i)
+	}
+	var ps []*post
+	for _, p := range posts {
+		slices.SortStableFunc(p.images, func(a, b *image) int {
+			return a.Index - b.Index
+		})
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// ImagesPerDay returns the images of an images_per_day section grouped by day.
+func (s *Section) ImagesPerDay() map[time.Time][]*image {
+	days := make(map[time.Time][]*image)
+	for _, i := range s.images() {
+		day := truncateDay(i.PublishedAt.In(tz))
+		days[day] = append(days[day], i)
+	}
+	for day := range days {
+		days[day] = s.sortImages(days[day])
+	}
+	return days
+}
+
+// PostsPerDay returns the posts of a posts_per_day section grouped by day.
+func (s *Section) PostsPerDay() map[time.Time][]*post {
+	days := make(map[time.Time][]*post)
+	for _, p := range s.posts() {
+		day := truncateDay(p.PublishedAt().In(tz))
+		days[day] = append(days[day], p)
+	}
+	for day := range days {
+		days[day] = s.sortPosts(days[day])
+	}
+	return days
+}
+
+// StatsRow is a row of a stats section.
+type StatsRow struct {
+	Title  string
+	Scores stats.Float64Data
+}
+
+// Rows returns the image scores of every window of a stats section.
+func (s *Section) Rows() []StatsRow {
+	return Map(s.Windows, func(w NamedWindow) StatsRow {
+		images := Filter(s.data.Images(), func(i *image) bool {
+			return w.Contains(i.PublishedAt)
+		})
+		return StatsRow{
+			Title: w.Title,
+			Scores: Map(images, func(i *image) float64 {
+				return float64(i.Score())
+			}),
+		}
+	})
+}
+
+// Tests runs the comparisons of a significance section.
+func (s *Section) Tests() []*Significance {
+	return Map(s.Comparisons, func(c Comparison) *Significance {
+		return c.Test(s.data, defaultResamples)
+	})
+}
+
+// Leaderboard returns the leaderboard of a leaderboard section.
+func (s *Section) Leaderboard() *Leaderboard {
+	return s.data.Leaderboard()
+}
+
+// Anomalies returns the images of an anomalies section that performed far from
+// expectation, largest deviation first. The baseline is fitted to every image, the
+// window and score bounds only select which anomalies are listed.
+func (s *Section) Anomalies() ([]*Anomaly, error) {
+	a := &AnomalyDetector{Threshold: s.Threshold, MinAge: s.MinAge}
+	if a.Threshold == 0 {
+		a.Threshold = 3
+	}
+	if a.MinAge == 0 {
+		a.MinAge = 24 * time.Hour
+	}
+	anomalies, err := a.Detect(s.data.Posts())
+	if errors.Is(err, errTooFewImages) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	in := make(map[int]bool)
+	for _, i := range s.images() {
+		in[i.ID] = true
+	}
+	anomalies = Filter(anomalies, func(a *Anomaly) bool {
+		return in[a.ID]
+	})
+	return anomalies[:s.limit(len(anomalies))], nil
+}
+
+// Analysis returns the analysis of the posts of a post_analysis section.
+func (s *Section) Analysis() *PostAnalysis {
+	minAge, minPosts := s.MinAge, s.MinPosts
+	if minAge == 0 {
+		minAge = 72 * time.Hour
+	}
+	if minPosts == 0 {
+		minPosts = 3
+	}
+	return analyzePosts(s.posts(), minAge, minPosts)
+}
+
+// Resources returns the breakdown of a resources section by base model, resource
+// and tag, or nil if no metadata was loaded. Top limits the rows of each table.
+func (s *Section) Resources() *ResourceBreakdown {
+	if s.data.meta == nil {
+		return nil
+	}
+	minImages := s.MinImages
+	if minImages == 0 {
+		minImages = 3
+	}
+	b := breakdownResources(s.images(), s.data.meta, minImages)
+	b.BaseModels = b.BaseModels[:s.limit(len(b.BaseModels))]
+	b.Resources = b.Resources[:s.limit(len(b.Resources))]
+	b.Tags = b.Tags[:s.limit(len(b.Tags))]
+	return b
+}
+
+// Prompts returns the prompt terms of a prompts section ranked by their correlation
+// with score, or nil if no metadata was loaded. Top limits the number of terms.
+func (s *Section) Prompts() []PromptTermStats {
+	if s.data.meta == nil {
+		return nil
+	}
+	minImages := s.MinImages
+	if minImages == 0 {
+		minImages = 5
+	}
+	terms := analyzePrompts(s.images(), s.data.meta, minImages)
+	return terms[:s.limit(len(terms))]
+}
+
+// Hours returns the images of an hours section grouped by the hour they were published.
+func (s *Section) Hours() [][]*image {
+	hours := make([][]*image, 24)
+	for _, i := range s.images() {
+		hours[i.Hour()] = append(hours[i.Hour()], i)
+	}
+	return hours
+}
+
+// Contents returns the sections that can be linked to from a contents section.
+func (s *Section) Contents() []*Section {
+	return Filter(s.sections, func(o *Section) bool {
+		return o.ID != "" && o.Title != "" && o != s
+	})
+}
+
+// parseReportDefinition parses a YAML or JSON report definition.
+func parseReportDefinition(b []byte) (*ReportDefinition, error) {
+	var def ReportDefinition
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&def); err != nil {
+		return nil, err
+	}
+	for _, s := range def.Sections {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &def, nil
+}
+
+// loadReportDefinition reads the definition at path, or the default definition if path is empty.
+func loadReportDefinition(path string) (*ReportDefinition, error) {
+	if path == "" {
+		return parseReportDefinition(reportYAML)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseReportDefinition(b)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/d00918380/civit/internal/civit"
+	"github.com/d00918380/civit/internal/trpc"
+)
+
+// imageMeta is the generation metadata and tags of an image, written by images meta.
+type imageMeta struct {
+	ID        int             `json:"id"`
+	BaseModel string          `json:"baseModel,omitempty"`
+	Meta      *civit.ItemMeta `json:"meta,omitempty"`
+	Tags      []string        `json:"tags"`
+}
+
+// resource is a model used to generate an image.
+type resource struct {
+	Type string
+	Name string
+}
+
+// resources returns the models used to generate the image. civitaiResources only
+// carry the model version, so they are named by version name and id; resources
+// parsed from the generation parameters carry the model name.
+func (m *imageMeta) resources() []resource {
+	if m.Meta == nil {
+		return nil
+	}
+	var rs []resource
+	for _, r := range m.Meta.CivitaiResources {
+		rs = append(rs, resource{Type: r.Type, Name: fmt.Sprintf("%s #%d", r.ModelVersionName, r.ModelVersionId)})
+	}
+	for _, r := range m.Meta.Resources {
+		r, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := r["name"].(string)
+		typ, _ := r["type"].(string)
+		if name != "" {
+			rs = append(rs, resource{Type: typ, Name: name})
+		}
+	}
+	slices.SortFunc(rs, func(a, b resource) int {
+		return cmp.Or(cmp.Compare(a.Type, b.Type), cmp.Compare(a.Name, b.Name))
+	})
+	return slices.Compact(rs)
+}
+
+// readImageMeta reads a file written by images meta, keyed by image id.
+func readImageMeta(path string) (map[int]*imageMeta, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var metas []*imageMeta
+	if err := json.Unmarshal(b, &metas); err != nil {
+		return nil, err
+	}
+	m := make(map[int]*imageMeta, len(metas))
+	for _, meta := range metas {
+		m[meta.ID] = meta
+	}
+	return m, nil
+}
+
+// MetaFetcher archives the generation metadata and tags of a user's images.
+type MetaFetcher struct {
+	civit *civit.Client
+	trpc  *trpc.Client
+	// interval is the minimum delay between tag requests.
+	interval time.Duration
+	// refetch is the age below which tags are fetched again, they're still being voted on.
+	refetch time.Duration
+}
+
+// Fetch returns the metadata of every image of username. Tags are only fetched for
+// images that aren't in previous, whose tags failed to fetch or that are younger than
+// refetch, tags rarely change once an image is a few days old. When fetching fails
+// the archived tags are kept, nil if there were none, so the next run retries.
+func (f *MetaFetcher) Fetch(ctx context.Context, username string, previous map[int]*imageMeta) ([]*imageMeta, error) {
+	items, err := f.civit.ItemsForUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Fetched metadata of %d images", len(items))
+	limiter := time.NewTicker(max(f.interval, time.Millisecond))
+	defer limiter.Stop()
+
+	metas := make([]*imageMeta, 0, len(items))
+	for _, item := range items {
+		m := &imageMeta{ID: item.Id, BaseModel: item.BaseModel, Meta: item.Meta}
+		if p, ok := previous[item.Id]; ok && p.Tags != nil && time.Since(item.CreatedAt) >= f.refetch {
+			m.Tags = p.Tags
+		} else {
+			<-limiter.C
+			tags, err := f.trpc.ImageTags(ctx, item.Id)
+			if err != nil {
+				log.Printf("Error fetching tags of image %d: %v", item.Id, err)
+				if ok {
+					m.Tags = p.Tags
+				}
+			} else {
+				m.Tags = Map(tags, func(t trpc.Tag) string {
+					return t.Name
+				})
+			}
+		}
+		metas = append(metas, m)
+	}
+	slices.SortFunc(metas, func(a, b *imageMeta) int {
+		return b.ID - a.ID
+	})
+	return metas, nil
+}
+
+// ResourceStats is the performance of the images using one base model, resource or tag.
+type ResourceStats struct {
+	// Type is the resource type, such as lora or checkpoint, empty for base models and tags.
+	Type   string
+	Name   string
+	Images int
+	Posts  int
+	Score  int
+	Mean   float64
+	// Efficiency is the mean score per image of the posts with an image using the resource.
+	Efficiency float64
+	// Lift is Mean divided by the mean score of every image with metadata.
+	Lift float64
+}
+
+// ResourceBreakdown is the performance of images by base model, resource and tag.
+type ResourceBreakdown struct {
+	BaseModels []ResourceStats
+	Resources  []ResourceStats
+	Tags       []ResourceStats
+	// Images is the number of images with metadata, Missing the number without.
+	Images, Missing int
+}
+
+// ResourceTable is one table of a resource breakdown.
+type ResourceTable struct {
+	Title string
+	Rows  []ResourceStats
+}
+
+// Tables returns the base models, resources and tags as tables.
+func (b *ResourceBreakdown) Tables() []ResourceTable {
+	return []ResourceTable{
+		{"base model", b.BaseModels},
+		{"resource", b.Resources},
+		{"tag", b.Tags},
+	}
+}
+
+// breakdownResources aggregates the images by their metadata. Rows with fewer than
+// minImages images are left out, the rest are sorted by mean score, best first.
+func breakdownResources(images []*image, meta map[int]*imageMeta, minImages int) *ResourceBreakdown {
+	b := &ResourceBreakdown{}
+	type group struct {
+		ResourceStats
+		posts map[int]*post
+	}
+	bases := make(map[string]*group)
+	resources := make(map[resource]*group)
+	tags := make(map[string]*group)
+	add := func(g *group, i *image) {
+		g.Images++
+		g.Score += i.Score()
+		if g.posts[i.PostID] == nil {
+			g.posts[i.PostID] = &post{}
+		}
+		g.posts[i.PostID].images = append(g.posts[i.PostID].images, i)
+	}
+	get := func(m map[string]*group, key string) *group {
+		if m[key] == nil {
+			m[key] = &group{ResourceStats: ResourceStats{Name: key}, posts: make(map[int]*post)}
+		}
+		return m[key]
+	}
+
+	var total int
+	for _, i := range images {
+		m := meta[i.ID]
+		if m == nil {
+			b.Missing++
+			continue
+		}
+		b.Images++
+		total += i.Score()
+		if m.BaseModel != "" {
+			add(get(bases, m.BaseModel), i)
+		}
+		for _, r := range m.resources() {
+			if resources[r] == nil {
+				resources[r] = &group{ResourceStats: ResourceStats{Type: r.Type, Name: r.Name}, posts: make(map[int]*post)}
+			}
+			add(resources[r], i)
+		}
+		for _, t := range m.Tags {
+			add(get(tags, strings.ToLower(t)), i)
+		}
+	}
+
+	overall := float64(total) / float64(max(b.Images, 1))
+	rows := func(groups []*group) []ResourceStats {
+		var rows []ResourceStats
+		for _, g := range groups {
+			if g.Images < minImages {
+				continue
+			}
+			g.Posts = len(g.posts)
+			g.Mean = float64(g.Score) / float64(g.Images)
+			for _, p := range g.posts {
+				g.Efficiency += p.Efficiency()
+			}
+			g.Efficiency /= float64(g.Posts)
+			if overall > 0 {
+				g.Lift = g.Mean / overall
+			}
+			rows = append(rows, g.ResourceStats)
+		}
+		slices.SortStableFunc(rows, func(a, b ResourceStats) int {
+			return cmp.Or(cmp.Compare(b.Mean, a.Mean), cmp.Compare(a.Name, b.Name))
+		})
+		return rows
+	}
+	b.BaseModels = rows(slices.Collect(maps.Values(bases)))
+	b.Resources = rows(slices.Collect(maps.Values(resources)))
+	b.Tags = rows(slices.Collect(maps.Values(tags)))
+	return b
+}
+
+// printResources writes a resource breakdown as tables.
+func printResources(w io.Writer, b *ResourceBreakdown) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, table := range b.Tables() {
+		fmt.Fprintf(tw, "%s\ttype\timages\tposts\tscore\tmean\tefficiency\tlift\n", table.Title)
+		for _, r := range table.Rows {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%.1f\t%.1f\t%.2f\n", r.Name, r.Type, r.Images, r.Posts, r.Score, r.Mean, r.Efficiency, r.Lift)
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d images with metadata, %d without.\n", b.Images, b.Missing)
+	return err
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/montanaflynn/stats"
+)
+
+// slot is a weekday and hour of the week in a particular location.
+type slot struct {
+	Weekday time.Weekday
+	Hour    int
+}
+
+// Next returns the start of the first occurrence of the slot after t.
+func (s slot) Next(t time.Time) time.Time {
+	day := truncateDay(t)
+	for i := range 8 {
+		d := day.AddDate(0, 0, i)
+		start := time.Date(d.Year(), d.Month(), d.Day(), s.Hour, 0, 0, 0, d.Location())
+		if d.Weekday() == s.Weekday && start.After(t) {
+			return start
+		}
+	}
+	panic("unreachable")
+}
+
+// slotEstimate is the expected performance of posts published in a slot.
+type slotEstimate struct {
+	slot
+	N int
+	// Mean is the expected score per image, Low and High the bounds of its 95% confidence interval.
+	Mean, Low, High float64
+}
+
+// Scheduler models expected score per image by weekday and hour of publishing.
+type Scheduler struct {
+	// Location in which weekdays and hours are evaluated.
+	Location *time.Location
+	// MinAge excludes posts that are still accumulating reactions.
+	MinAge time.Duration
+	// MinSamples is the minimum number of posts in a slot for it to be recommended.
+	MinSamples int
+}
+
+// Estimate returns an estimate for every slot that has at least one post.
+//
+// Each post is scored by its efficiency relative to the mean efficiency of posts with
+// the same number of images, which controls for post size. The per slot mean of these
+// ratios is then scaled back to points using the overall mean efficiency.
+func (s *Scheduler) Estimate(posts []*post) []*slotEstimate {
+	cutoff := time.Now().Add(-s.MinAge)
+	posts = Filter(posts, func(p *post) bool {
+		return p.PublishedAt().Before(cutoff)
+	})
+	if len(posts) == 0 {
+		return nil
+	}
+
+	// posts with many images are rare, pool them together
+	size := func(p *post) int {
+		return min(len(p.Images()), 6)
+	}
+	bySize := make(map[int]stats.Float64Data)
+	var all stats.Float64Data
+	for _, p := range posts {
+		bySize[size(p)] = append(bySize[size(p)], p.Efficiency())
+		all = append(all, p.Efficiency())
+	}
+	overall, _ := all.Mean()
+	expected := make(map[int]float64)
+	for n, effs := range bySize {
+		expected[n], _ = effs.Mean()
+	}
+
+	ratios := make(map[slot]stats.Float64Data)
+	for _, p := range posts {
+		e := expected[size(p)]
+		if e == 0 {
+			continue
+		}
+		t := p.PublishedAt().In(s.Location)
+		sl := slot{t.Weekday(), t.Hour()}
+		ratios[sl] = append(ratios[sl], p.Efficiency()/e)
+	}
+
+	var estimates []*slotEstimate
+	for sl, r := range ratios {
+		mean, _ := r.Mean()
+		var se float64
+		if len(r) > 1 {
+			sd, _ := r.StandardDeviationSample()
+			se = sd / math.Sqrt(float64(len(r)))
+		}
+		estimates = append(estimates, &slotEstimate{
+			slot: sl,
+			N:    len(r),
+			Mean: mean * overall,
+			Low:  math.Max(0, mean-1.96*se) * overall,
+			High: (mean + 1.96*se) * overall,
+		})
+	}
+	// rank by the lower bound so that slots with few, noisy samples don't dominate
+	slices.SortFunc(estimates, func(a, b *slotEstimate) int {
+		if c := cmp.Compare(b.Low, a.Low); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Mean, a.Mean)
+	})
+	return estimates
+}
+
+// Suggest writes the top ranked slots and the best slot for each of the next seven days.
+func (s *Scheduler) Suggest(w io.Writer, posts []*post, top int) error {
+	estimates := Filter(s.Estimate(posts), func(e *slotEstimate) bool {
+		return e.N >= s.MinSamples
+	})
+	if len(estimates) == 0 {
+		return fmt.Errorf("no slot has at least %d posts older than %v", s.MinSamples, s.MinAge)
+	}
+	now := time.Now().In(s.Location)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Best slots (%s)\n", s.Location)
+	fmt.Fprintf(tw, "weekday\thour\tposts\tscore/image\t95%% CI\tnext\n")
+	for _, e := range estimates[:min(top, len(estimates))] {
+		fmt.Fprintf(tw, "%s\t%02d:00\t%d\t%.1f\t%.1f - %.1f\t%s\n", e.Weekday, e.Hour, e.N, e.Mean, e.Low, e.High, e.Next(now).Format("Mon 2006-01-02 15:04"))
+	}
+	fmt.Fprintf(tw, "\nNext week\n")
+	for i := range 7 {
+		day := truncateDay(now).AddDate(0, 0, i)
+		j := slices.IndexFunc(estimates, func(e *slotEstimate) bool {
+			return e.Weekday == day.Weekday() && (i > 0 || e.Next(now).Before(day.AddDate(0, 0, 1)))
+		})
+		if j < 0 {
+			fmt.Fprintf(tw, "%s\t-\n", day.Format("Mon 2006-01-02"))
+			continue
+		}
+		e := estimates[j]
+		fmt.Fprintf(tw, "%s\t%02d:00\t%d\t%.1f\t%.1f - %.1f\n", day.Format("Mon 2006-01-02"), e.Hour, e.N, e.Mean, e.Low, e.High)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+//go:generate curl -sSfL -o scripts/d3.min.js https://cdn.jsdelivr.net/npm/d3@7.9.0/dist/d3.min.js
+//go:generate curl -sSfL -o scripts/plot.umd.min.js https://cdn.jsdelivr.net/npm/@observablehq/plot@0.6.16/dist/plot.umd.min.js
+
+// vendoredScripts holds d3 and Observable Plot for offline reports, see scripts/README.md.
+//
+//go:embed scripts
+var vendoredScripts embed.FS
+
+// offlineScripts returns d3 and Plot to inline into an offline report. It fails if
+// they haven't been fetched with go generate.
+func offlineScripts() (template.JS, error) {
+	var b strings.Builder
+	for _, name := range []string{"scripts/d3.min.js", "scripts/plot.umd.min.js"} {
+		s, err := vendoredScripts.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("%s isn't vendored, fetch it with go generate: %w", name, err)
+		}
+		// a literal </script> would end the inline script element
+		b.WriteString(strings.ReplaceAll(string(s), "</script", `<\/script`))
+		b.WriteString(";\n")
+	}
+	return template.JS(b.String()), nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	stdcsv "encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d00918380/civit/internal/trpc"
+)
+
+// Server serves the report and its data over HTTP.
+//
+// The input dump, definition and template are read on every request, so rerunning
+// `images metadata` or `images refresh` is picked up by reloading the page.
+type Server struct {
+	// Input is the dump written by images metadata.
+	Input string
+	// Definition and Template are as for the report command.
+	Definition, Template string
+	// Reactions is the images.csv history written by reactions.
+	Reactions string
+	// Thumbs inlines thumbnails of downloaded images, may be nil.
+	Thumbs *thumbnailer
+}
+
+// Handler returns the handler serving
+//
+//	/                 the report
+//	/api/images       images as JSON
+//	/api/posts        posts as JSON
+//	/api/leaderboard  the leaderboard as JSON
+//	/api/reactions    the score history of images tracked by reactions, ?id= selects an image
+//
+// The report and the images, posts and leaderboard endpoints accept the query
+// parameters from and to (YYYY-MM-DD in --tz), user (a username) and score (one of
+// the score formulas).
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.report)
+	mux.HandleFunc("GET /api/images", s.api(func(d *data) any {
+		return d.ImagesJSON()
+	}))
+	mux.HandleFunc("GET /api/posts", s.api(func(d *data) any {
+		return d.PostsJSON()
+	}))
+	mux.HandleFunc("GET /api/leaderboard", s.api(func(d *data) any {
+		l := d.Leaderboard()
+		return map[string]any{
+			"score": l.Score(),
+			"entries": Map(l.Entries, func(e *LeaderboardEntry) any {
+				return map[string]any{
+					"id":            e.ID,
+					"imageURL":      e.ImageURL(),
+					"postURL":       e.PostURL(),
+					"score":         e.Score(),
+					"adjustedScore": e.AdjustedScore,
+					"createdAt":     e.PublishedAt,
+				}
+			}),
+		}
+	}))
+	mux.HandleFunc("GET /api/reactions", s.reactions)
+	return mux
+}
+
+// load reads the input and applies the query parameters of r.
+func (s *Server) load(r *http.Request) (*data, error) {
+	q := r.URL.Query()
+	from, err := parseDate(q.Get("from"))
+	if err != nil {
+		return nil, fmt.Errorf("from: %w", err)
+	}
+	to, err := parseDate(q.Get("to"))
+	if err != nil {
+		return nil, fmt.Errorf("to: %w", err)
+	}
+	var formula scoreFormula
+	if name := q.Get("score"); name != "" {
+		var ok bool
+		if formula, ok = scoreFormulas[name]; !ok {
+			return nil, fmt.Errorf("unknown score formula %q", name)
+		}
+	}
+	user := q.Get("user")
+
+	items, err := readItems(s.Input)
+	if err != nil {
+		return nil, err
+	}
+	items = Filter(items, func(i *trpc.Item) bool {
+		switch {
+		case !i.Published():
+			return false
+		case !from.IsZero() && i.PublishedAt.Before(from):
+			return false
+		case !to.IsZero() && !i.PublishedAt.Before(to):
+			return false
+		case user != "" && !strings.EqualFold(i.User.Username, user):
+			return false
+		}
+		return true
+	})
+	return &data{
+		Items:   items,
+		thumbs:  s.Thumbs,
+		formula: formula,
+		query:   q,
+	}, nil
+}
+
+func (s *Server) report(w http.ResponseWriter, r *http.Request) {
+	d, err := s.load(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	def, err := loadReportDefinition(s.Definition)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	// render to a buffer so a failing template doesn't leave half a page
+	var buf bytes.Buffer
+	if err := d.render(&buf, def, s.Template); err != nil {
+		serverError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// api returns a handler writing f of the loaded data as JSON.
+func (s *Server) api(f func(*data) any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, err := s.load(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, f(d))
+	}
+}
+
+// reactionSample is a row of images.csv.
+type reactionSample struct {
+	Time  time.Time `json:"ts"`
+	ID    int       `json:"id"`
+	Score int       `json:"score"`
+}
+
+func (s *Server) reactions(w http.ResponseWriter, r *http.Request) {
+	var id int
+	if v := r.URL.Query().Get("id"); v != "" {
+		var err error
+		if id, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "id: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	samples, err := readReactions(s.Reactions)
+	if err != nil && !os.IsNotExist(err) {
+		serverError(w, err)
+		return
+	}
+	if id != 0 {
+		samples = Filter(samples, func(s reactionSample) bool {
+			return s.ID == id
+		})
+	}
+	if samples == nil {
+		samples = []reactionSample{}
+	}
+	writeJSON(w, samples)
+}
+
+// readReactions reads the ts,id,score rows appended to images.csv by reactions.
+func readReactions(path string) ([]reactionSample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := stdcsv.NewReader(f)
+	r.FieldsPerRecord = 3
+	var samples []reactionSample
+	for {
+		rec, err := r.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		// reactions writes timestamps in the local time zone of the machine running it
+		ts, err := time.ParseInLocation(time.DateTime, rec[0], time.Local)
+		if err != nil {
+			return nil, err
+		}
+		id, err := strconv.Atoi(rec[1])
+		if err != nil {
+			return nil, err
+		}
+		score, err := strconv.Atoi(rec[2])
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, reactionSample{Time: ts, ID: id, Score: score})
+	}
+	slices.SortStableFunc(samples, func(a, b reactionSample) int {
+		return a.Time.Compare(b.Time)
+	})
+	return samples, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
+
+func serverError(w http.ResponseWriter, err error) {
+	log.Println("Error:", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/montanaflynn/stats"
+)
+
+// Group selects the images or posts on one side of a comparison.
+type Group struct {
+	Title  string `yaml:"title"`
+	Window `yaml:",inline"`
+	// MinImages and MaxImages restrict the group to posts with that many images, zero for no bound.
+	MinImages int `yaml:"min_images"`
+	MaxImages int `yaml:"max_images"`
+	// Hours restricts the group to images published in these hours of the day, empty for all.
+	Hours []int `yaml:"hours"`
+	// Tags restricts the group to images with one of these tags in the metadata written
+	// by images meta, empty for all.
+	Tags []string `yaml:"tags"`
+}
+
+// posts returns the posts in the group, a post only contains the images published
+// inside the window and hours that have one of the tags.
+func (g *Group) posts(d *data) []*post {
+	var posts []*post
+	for _, p := range d.Posts() {
+		if g.MinImages > 0 && len(p.images) < g.MinImages {
+			continue
+		}
+		if g.MaxImages > 0 && len(p.images) > g.MaxImages {
+			continue
+		}
+		images := Filter(p.images, func(i *image) bool {
+			return g.Contains(i.PublishedAt) && (len(g.Hours) == 0 || slices.Contains(g.Hours, i.Hour())) &&
+				g.tagged(d, i)
+		})
+		if len(images) > 0 {
+			posts = append(posts, &post{images: images})
+		}
+	}
+	return posts
+}
+
+// tagged reports whether the image has one of the group's tags, images without
+// metadata have none.
+func (g *Group) tagged(d *data, i *image) bool {
+	if len(g.Tags) == 0 {
+		return true
+	}
+	m := d.meta[i.ID]
+	if m == nil {
+		return false
+	}
+	return slices.ContainsFunc(m.Tags, func(t string) bool {
+		return slices.ContainsFunc(g.Tags, func(want string) bool {
+			return strings.EqualFold(t, want)
+		})
+	})
+}
+
+// groupFlags are the images significance flags selecting a Group.
+type groupFlags struct {
+	Title     string        `help:"Name of the group."`
+	From      time.Duration `help:"How long ago the group starts, 0 for the beginning of time."`
+	To        time.Duration `help:"How long ago the group ends, 0 for now."`
+	MinImages int           `help:"Only posts with at least this many images."`
+	MaxImages int           `help:"Only posts with at most this many images."`
+	Hours     []int         `help:"Only images published in these hours of the day."`
+	Tag       []string      `help:"Only images with one of these tags, read from --meta."`
+}
+
+func (f groupFlags) group() Group {
+	return Group{
+		Title:     f.Title,
+		Window:    Window{From: f.From, To: f.To},
+		MinImages: f.MinImages,
+		MaxImages: f.MaxImages,
+		Hours:     f.Hours,
+		Tags:      f.Tag,
+	}
+}
+
+// Comparison is a test of whether two groups differ.
+type Comparison struct {
+	Title string `yaml:"title"`
+	A     Group  `yaml:"a"`
+	B     Group  `yaml:"b"`
+	// Metric is score, the score per image, or efficiency, the score per image of posts.
+	Metric string `yaml:"metric"`
+}
+
+func (c *Comparison) metric() string {
+	if c.Metric == "" {
+		return "score"
+	}
+	return c.Metric
+}
+
+func (c *Comparison) validate() error {
+	switch c.metric() {
+	case "score", "efficiency":
+		return nil
+	default:
+		return fmt.Errorf("comparison %q: unknown metric %q", c.Title, c.Metric)
+	}
+}
+
+// values returns the metric of every image or post in g.
+func (c *Comparison) values(d *data, g *Group) []float64 {
+	posts := g.posts(d)
+	if c.metric() == "efficiency" {
+		return Map(posts, func(p *post) float64 {
+			return p.Efficiency()
+		})
+	}
+	var values []float64
+	for _, p := range posts {
+		for _, i := range p.images {
+			values = append(values, float64(i.Score()))
+		}
+	}
+	return values
+}
+
+// defaultResamples is the number of bootstrap resamples of significance sections.
+const defaultResamples = 2000
+
+// Test compares the groups, resampling the difference of their means resamples times.
+func (c *Comparison) Test(d *data, resamples int) *Significance {
+	a, b := c.values(d, &c.A), c.values(d, &c.B)
+	s := &Significance{
+		Title:  c.Title,
+		Metric: c.metric(),
+		A:      summarizeGroup(c.A.Title, a),
+		B:      summarizeGroup(c.B.Title, b),
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return s
+	}
+	s.Diff = s.B.Mean - s.A.Mean
+	s.U, s.P, s.CliffsDelta = mannWhitney(a, b)
+	s.CohensD = cohensD(a, b)
+	s.Low, s.High = bootstrapDiff(a, b, resamples)
+	return s
+}
+
+// GroupSummary describes one side of a comparison.
+type GroupSummary struct {
+	Title  string
+	N      int
+	Mean   float64
+	Median float64
+}
+
+func summarizeGroup(title string, values []float64) GroupSummary {
+	g := GroupSummary{Title: title, N: len(values)}
+	g.Mean, _ = stats.Mean(values)
+	g.Median, _ = stats.Median(values)
+	return g
+}
+
+// Significance is the result of a comparison. Effect sizes are positive when B is larger.
+type Significance struct {
+	Title  string
+	Metric string
+	A, B   GroupSummary
+	// Diff is the difference of the means, B - A, and Low and High its 95% bootstrap
+	// confidence interval.
+	Diff, Low, High float64
+	// U is the Mann-Whitney U statistic of B and P its two sided p-value.
+	U, P float64
+	// CliffsDelta is the probability that a value of B is larger than one of A minus
+	// the probability that it's smaller, between -1 and 1.
+	CliffsDelta float64
+	// CohensD is Diff divided by the pooled standard deviation.
+	CohensD float64
+}
+
+// Significant reports whether the groups differ at the 5% level.
+func (s *Significance) Significant() bool {
+	return s.A.N > 0 && s.B.N > 0 && s.P < 0.05
+}
+
+// Magnitude describes the absolute Cliff's delta with the usual thresholds.
+func (s *Significance) Magnitude() string {
+	switch d := math.Abs(s.CliffsDelta); {
+	case d < 0.147:
+		return "negligible"
+	case d < 0.33:
+		return "small"
+	case d < 0.474:
+		return "medium"
+	default:
+		return "large"
+	}
+}
+
+// mannWhitney returns the U statistic of b, its two sided p-value using the normal
+// approximation with tie correction, and Cliff's delta.
+func mannWhitney(a, b []float64) (u, p, delta float64) {
+	type value struct {
+		v float64
+		b bool
+	}
+	values := make([]value, 0, len(a)+len(b))
+	for _, v := range a {
+		values = append(values, value{v, false})
+	}
+	for _, v := range b {
+		values = append(values, value{v, true})
+	}
+	slices.SortFunc(values, func(x, y value) int {
+		return cmp.Compare(x.v, y.v)
+	})
+
+	// rank, averaging the ranks of ties
+	var rankSumB, ties float64
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j].v == values[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if values[k].b {
+				rankSumB += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	na, nb, n := float64(len(a)), float64(len(b)), float64(len(values))
+	u = rankSumB - nb*(nb+1)/2
+	delta = 2*u/(na*nb) - 1
+
+	mean := na * nb / 2
+	sigma := math.Sqrt(na * nb / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return u, 1, delta
+	}
+	// continuity correction
+	z := (math.Abs(u-mean) - 0.5) / sigma
+	p = math.Erfc(max(z, 0) / math.Sqrt2)
+	return u, p, delta
+}
+
+// cohensD returns the difference of the means of b and a divided by their pooled
+// standard deviation.
+func cohensD(a, b []float64) float64 {
+	if len(a)+len(b) <= 2 {
+		return 0
+	}
+	ma, _ := stats.Mean(a)
+	mb, _ := stats.Mean(b)
+	va, _ := stats.SampleVariance(a)
+	vb, _ := stats.SampleVariance(b)
+	na, nb := float64(len(a)), float64(len(b))
+	pooled := math.Sqrt(((na-1)*va + (nb-1)*vb) / (na + nb - 2))
+	if pooled == 0 {
+		return 0
+	}
+	return (mb - ma) / pooled
+}
+
+// bootstrapDiff returns the 95% percentile bootstrap confidence interval of the
+// difference of the means of b and a. The resampling is seeded so reports are
+// reproducible.
+func bootstrapDiff(a, b []float64, resamples int) (low, high float64) {
+	if resamples <= 0 {
+		return math.NaN(), math.NaN()
+	}
+	r := rand.New(rand.NewPCG(1, 2))
+	resample := func(s []float64) float64 {
+		var sum float64
+		for range s {
+			sum += s[r.IntN(len(s))]
+		}
+		return sum / float64(len(s))
+	}
+	diffs := make([]float64, resamples)
+	for i := range diffs {
+		diffs[i] = resample(b) - resample(a)
+	}
+	low, _ = stats.Percentile(diffs, 2.5)
+	high, _ = stats.Percentile(diffs, 97.5)
+	return low, high
+}
+
+// printSignificance writes a comparison for the terminal.
+func printSignificance(w io.Writer, s *Significance) {
+	for _, g := range []GroupSummary{s.A, s.B} {
+		fmt.Fprintf(w, "%-10s n=%-5d mean=%.2f median=%.2f\n", g.Title, g.N, g.Mean, g.Median)
+	}
+	if s.A.N == 0 || s.B.N == 0 {
+		fmt.Fprintln(w, "not enough data to compare")
+		return
+	}
+	fmt.Fprintf(w, "difference of means (B - A): %+.2f, 95%% CI [%+.2f, %+.2f]\n", s.Diff, s.Low, s.High)
+	fmt.Fprintf(w, "Mann-Whitney U=%.0f p=%.4f\n", s.U, s.P)
+	fmt.Fprintf(w, "Cliff's delta=%+.3f (%s), Cohen's d=%+.3f\n", s.CliffsDelta, s.Magnitude(), s.CohensD)
+	if s.Significant() {
+		fmt.Fprintln(w, "the groups differ significantly at the 5% level")
+	} else {
+		fmt.Fprintln(w, "no significant difference at the 5% level")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"iter"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/d00918380/civit/internal/trpc"
+)
+
+// readItems reads a JSON dump produced by `images metadata`.
+func readItems(path string) ([]*trpc.Item, error) {
+	var items []*trpc.Item
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// syncImages merges the newest images from seq into previous.
+// seq must be sorted newest first. Images published within window are always
+// refetched so their stats are current; pagination stops at the first image
+// that is already known and was published before the window.
+func syncImages(seq iter.Seq2[trpc.Item, error], previous []*trpc.Item, window time.Duration) ([]*trpc.Item, error) {
+	known := make(map[int]*trpc.Item, len(previous))
+	for _, i := range previous {
+		known[i.ID] = i
+	}
+	cutoff := time.Now().Add(-window)
+	fetched := 0
+	for item, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		_, ok := known[item.ID]
+		if ok && item.Published() && item.PublishedAt.Before(cutoff) {
+			break
+		}
+		known[item.ID] = &item
+		fetched++
+	}
+	log.Printf("fetched %d images, %d known", fetched, len(previous))
+
+	items := make([]*trpc.Item, 0, len(known))
+	for _, i := range known {
+		items = append(items, i)
+	}
+	slices.SortStableFunc(items, func(a, b *trpc.Item) int {
+		if c := b.PublishedAt.Compare(a.PublishedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return items, nil
+}
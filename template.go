@@ -0,0 +1,39 @@
+package main
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// executeTemplate renders data with the template at path, or with the embedded
+// template src called name if path is empty.
+//
+// Templates ending in .html or .htm are parsed with html/template, everything else
+// with text/template so that, for example, CSV output isn't HTML escaped.
+func executeTemplate(w io.Writer, name, src, path string, funcs map[string]any, data any) error {
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, src = filepath.Base(path), string(b)
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".html", ".htm":
+		t, err := htmltemplate.New(name).Funcs(funcs).Parse(src)
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, data)
+	default:
+		t, err := texttemplate.New(name).Funcs(funcs).Parse(src)
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, data)
+	}
+}
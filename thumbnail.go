@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// thumbnailer inlines downsized copies of downloaded images into offline reports.
+type thumbnailer struct {
+	// dir contains the posts/<post id>/<url>.jpeg tree written by users download and posts download.
+	dir  string
+	size int
+
+	mu    sync.Mutex
+	cache map[int]template.URL
+}
+
+func newThumbnailer(dir string, size int) *thumbnailer {
+	return &thumbnailer{dir: dir, size: size, cache: make(map[int]template.URL)}
+}
+
+// Thumbnail returns a data URL of the downsized image, or "" if it hasn't been downloaded.
+func (t *thumbnailer) Thumbnail(i *image) template.URL {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if u, ok := t.cache[i.ID]; ok {
+		return u
+	}
+	u, err := t.thumbnail(i)
+	if err != nil {
+		u = ""
+	}
+	t.cache[i.ID] = u
+	return u
+}
+
+func (t *thumbnailer) thumbnail(i *image) (template.URL, error) {
+	path := filepath.Join(t.dir, "posts", strconv.Itoa(i.PostID), i.URL+".jpeg")
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	src, _, err := stdimage.Decode(f)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downsize(src, t.size), &jpeg.Options{Quality: 70}); err != nil {
+		return "", err
+	}
+	return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// downsize scales src so its longest side is at most size pixels, averaging the
+// source pixels that fall into each destination pixel.
+func downsize(src stdimage.Image, size int) stdimage.Image {
+	b := src.Bounds()
+	scale := float64(size) / float64(max(b.Dx(), b.Dy()))
+	if scale >= 1 {
+		return src
+	}
+	w, h := max(1, int(float64(b.Dx())*scale)), max(1, int(float64(b.Dy())*scale))
+	dst := stdimage.NewRGBA(stdimage.Rect(0, 0, w, h))
+	for y := range h {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := range w {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			var r, g, bl, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					cr, cg, cb, _ := src.At(sx, sy).RGBA()
+					r, g, bl, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), 0xffff})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/d00918380/civit/internal/phash"
+	"github.com/d00918380/civit/internal/trpc"
+)
+
+// Generation is an image saved by orchestrator download and the published image it
+// was matched to, if any.
+type Generation struct {
+	Path string
+	// Day is the day the image was generated, from its path.
+	Day time.Time
+	// Image is the published image, nil if the generation wasn't published.
+	Image *image
+	// MatchedBy is "hash" or "dimensions".
+	MatchedBy     string
+	width, height int
+}
+
+// GenerationDay is the publish rate of the images generated on one day.
+type GenerationDay struct {
+	Day       time.Time
+	Generated int
+	Published int
+	// Score is the total score of the published generations.
+	Score int
+}
+
+// Rate is the fraction of the generations that were published.
+func (d GenerationDay) Rate() float64 {
+	return float64(d.Published) / float64(max(d.Generated, 1))
+}
+
+// Triage matches the images saved by orchestrator download to the published images.
+type Triage struct {
+	// Dir contains the posts/ and generated/ directories.
+	Dir string
+	// Threshold is the largest Hamming distance of both the dHash and the pHash of
+	// a generation and the downloaded published image.
+	Threshold int
+	// Window is how long after the day of a generation an image of the same
+	// dimensions may be published to match it, when the published image wasn't
+	// downloaded.
+	Window time.Duration
+}
+
+// generationDay returns the day of a file saved as generated/YYYY/MM/DD/<id>,
+// falling back to its modification time.
+func generationDay(dir, path string) time.Time {
+	rel, err := filepath.Rel(filepath.Join(dir, "generated"), path)
+	if err == nil {
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) == 4 {
+			if t, err := time.Parse("2006/01/02", strings.Join(parts[:3], "/")); err == nil {
+				return t
+			}
+		}
+	}
+	if fi, err := os.Stat(path); err == nil {
+		return fi.ModTime().UTC().Truncate(24 * time.Hour)
+	}
+	return time.Time{}
+}
+
+// Match returns every generation, matched to the published images among items. A
+// generation matches the downloaded published image with the closest hashes within
+// Threshold that wasn't published before it. Published images that weren't
+// downloaded match a generation of the same dimensions published within Window of
+// its day, only if no other generation or published image is a candidate, as a
+// batch usually shares its dimensions. Each published image matches at most one
+// generation.
+func (t *Triage) Match(items []*trpc.Item) ([]*Generation, error) {
+	paths, err := generatedFiles(t.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var generated []*downloadedImage
+	for _, path := range paths {
+		img, err := hashImage(path)
+		if err != nil {
+			log.Printf("Error hashing %v", err)
+			continue
+		}
+		generated = append(generated, img)
+	}
+	var notDownloaded []*trpc.Item
+	var downloaded []*downloadedImage
+	for _, i := range items {
+		if !i.Published() {
+			continue
+		}
+		path := postsPath(t.Dir, i)
+		if _, err := os.Stat(path); err != nil {
+			notDownloaded = append(notDownloaded, i)
+			continue
+		}
+		img, err := hashImage(path)
+		if err != nil {
+			log.Printf("Error hashing %v", err)
+			notDownloaded = append(notDownloaded, i)
+			continue
+		}
+		img.Item = i
+		downloaded = append(downloaded, img)
+	}
+	log.Printf("Hashed %d generated and %d published images, %d published images weren't downloaded", len(generated), len(downloaded), len(notDownloaded))
+
+	generations := make([]*Generation, len(generated))
+	for n, g := range generated {
+		generations[n] = &Generation{Path: g.Path, Day: generationDay(t.Dir, g.Path), width: g.Width, height: g.Height}
+	}
+
+	// closest pairs first, so that each published image goes to its best match
+	type pair struct {
+		generation, published int
+		distance              int
+	}
+	var pairs []pair
+	for n, g := range generated {
+		for m, p := range downloaded {
+			if p.Item.PublishedAt.Before(generations[n].Day.Add(-24 * time.Hour)) {
+				continue // published before it was generated, allowing for time zones
+			}
+			dp, dd := phash.Distance(g.PHash, p.PHash), phash.Distance(g.DHash, p.DHash)
+			if dp <= t.Threshold && dd <= t.Threshold {
+				pairs = append(pairs, pair{n, m, dp + dd})
+			}
+		}
+	}
+	slices.SortStableFunc(pairs, func(a, b pair) int {
+		return cmp.Compare(a.distance, b.distance)
+	})
+	used := make(map[int]bool)
+	for _, p := range pairs {
+		if generations[p.generation].Image != nil || used[p.published] {
+			continue
+		}
+		used[p.published] = true
+		generations[p.generation].Image = &image{Item: downloaded[p.published].Item}
+		generations[p.generation].MatchedBy = "hash"
+	}
+
+	// candidates of each unmatched generation and each published image that wasn't
+	// downloaded, by dimensions and time
+	candidates := func(g *Generation, i *trpc.Item) bool {
+		if g.width != i.Width || g.height != i.Height {
+			return false
+		}
+		return !i.PublishedAt.Before(g.Day) && i.PublishedAt.Before(g.Day.Add(24*time.Hour+t.Window))
+	}
+	for _, i := range notDownloaded {
+		var match *Generation
+		var n int
+		for _, g := range generations {
+			if g.Image == nil && candidates(g, i) {
+				match = g
+				n++
+			}
+		}
+		if n != 1 {
+			continue
+		}
+		// the generation must not be a candidate for another published image either
+		var others int
+		for _, o := range notDownloaded {
+			if candidates(match, o) {
+				others++
+			}
+		}
+		if others == 1 {
+			match.Image = &image{Item: i}
+			match.MatchedBy = "dimensions"
+		}
+	}
+
+	slices.SortFunc(generations, func(a, b *Generation) int {
+		return cmp.Or(a.Day.Compare(b.Day), cmp.Compare(a.Path, b.Path))
+	})
+	return generations, nil
+}
+
+// generationDays returns the publish rate of the generations per day, oldest first.
+func generationDays(generations []*Generation) []GenerationDay {
+	var days []GenerationDay
+	for _, g := range generations {
+		if len(days) == 0 || !days[len(days)-1].Day.Equal(g.Day) {
+			days = append(days, GenerationDay{Day: g.Day})
+		}
+		d := &days[len(days)-1]
+		d.Generated++
+		if g.Image != nil {
+			d.Published++
+			d.Score += g.Image.Score()
+		}
+	}
+	return days
+}
+
+// printTriage writes the published generations and the publish rate per day.
+func printTriage(w io.Writer, generations []*Generation) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "generation\tmatched by\tscore\tpublished\turl\n")
+	for _, g := range generations {
+		if g.Image != nil {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", g.Path, g.MatchedBy, g.Image.Score(), g.Image.DateTime(), g.Image.ImageURL())
+		}
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "day\tgenerated\tpublished\trate\tscore\n")
+	var total GenerationDay
+	for _, d := range generationDays(generations) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\t%d\n", d.Day.Format(time.DateOnly), d.Generated, d.Published, d.Rate()*100, d.Score)
+		total.Generated += d.Generated
+		total.Published += d.Published
+		total.Score += d.Score
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t%.1f%%\t%d\n", total.Generated, total.Published, total.Rate()*100, total.Score)
+	return tw.Flush()
+}